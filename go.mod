@@ -13,14 +13,18 @@ require (
 	github.com/coreos/go-oidc/v3 v3.1.0
 	github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring v0.52.0
 	github.com/prometheus/alertmanager v0.23.0
+	github.com/prometheus/client_golang v1.11.1
 	github.com/prometheus/common v0.32.1
 	github.com/spf13/cobra v1.2.1
 	github.com/spf13/viper v1.13.0
 	github.com/vcraescu/go-paginator/v2 v2.0.0
 	golang.org/x/oauth2 v0.0.0-20220411215720-9780585627b5
+	golang.org/x/time v0.0.0-20210723032227-1f47c861a9ac
 	gopkg.in/telebot.v3 v3.1.3 // indirect
 	gopkg.in/tucnak/telebot.v3 v3.0.0-20211108093419-844466d6faf3
+	gopkg.in/yaml.v2 v2.4.0
 	k8s.io/api v0.22.3
+	k8s.io/apiextensions-apiserver v0.22.3
 	k8s.io/apimachinery v0.22.3
 	k8s.io/client-go v12.0.0+incompatible
 	sigs.k8s.io/controller-runtime v0.10.3
@@ -7,17 +7,26 @@ import (
 	"net/url"
 
 	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
-	"k8s.io/apimachinery/pkg/types"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// ReloadError is returned, when alertmanager failed to apply config on reload
+type ReloadError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ReloadError) Error() string {
+	return fmt.Sprintf("failed alertmanager reload with status code \"%d\" and body \"%s\"", e.StatusCode, e.Body)
+}
+
 type Alertmanager struct {
 	url, tp string
+	hc      *http.Client
 
 	*config.Config
 }
 
-func New(a, w, tp, ns, acd, acm string, kc client.Client) (*Alertmanager, error) {
+func New(a, w, tp string, dest, manual config.Storage) (*Alertmanager, error) {
 	if _, err := url.Parse(a); err != nil {
 		return nil, fmt.Errorf("given alertmanager url %s is incorrect: %s", a, err)
 	}
@@ -27,36 +36,37 @@ func New(a, w, tp, ns, acd, acm string, kc client.Client) (*Alertmanager, error)
 		return nil, fmt.Errorf("given webhook url %s is incorrect: %s", w, err)
 	}
 
-	var kd, km *types.NamespacedName
-	kd = &types.NamespacedName{Namespace: ns, Name: acd}
+	c := config.New(dest, manual, wu)
 
-	if acm != "" {
-		km = &types.NamespacedName{Namespace: ns, Name: acm}
-	}
-
-	c := config.New(kd, km, wu, kc)
-
-	return &Alertmanager{url: a, tp: tp, Config: c}, nil
+	return &Alertmanager{url: a, tp: tp, hc: &http.Client{}, Config: c}, nil
 }
 
-func (a *Alertmanager) Reload() (*http.Response, error) {
-	resp, err := http.Post(
+// Reload makes alertmanager reload its config, ReloadError is returned if
+// alertmanager rejected config, other errors mean it wasn't reached.
+func (a *Alertmanager) Reload() error {
+	// operator reloads alertmanager itself after config resources changes
+	if a.Config.SelfReloading() {
+		return nil
+	}
+
+	resp, err := a.hc.Post(
 		fmt.Sprintf("%s/-/reload", a.url),
 		"application/x-www-form-urlencoded",
 		nil,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed reload alertmanager: %s", err)
+		return fmt.Errorf("failed reload alertmanager: %s", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return resp, fmt.Errorf("response body read failed: %s", err)
+			return fmt.Errorf("response body read failed: %s", err)
 		}
 
-		return resp, fmt.Errorf("failed alertmanager reload with status code \"%d\" and body \"%s\"", resp.StatusCode, body)
+		return &ReloadError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
-	return resp, nil
+	return nil
 }
@@ -0,0 +1,278 @@
+package alertmanager
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
+)
+
+func newTestAlertmanager(t *testing.T, h http.Handler) *Alertmanager {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "alertmanager.yml")
+	a, err := New(srv.URL, "http://bot/webhook", "", config.NewFileStorage(path), nil)
+	if err != nil {
+		t.Fatalf("failed to create alertmanager client: %s", err)
+	}
+
+	return a
+}
+
+func writeJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	t.Helper()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Errorf("failed to encode response: %s", err)
+	}
+}
+
+func TestListAlerts(t *testing.T) {
+	a := newTestAlertmanager(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("receiver"); got != "tg--100" {
+			t.Errorf("unexpected receiver query %q", got)
+		}
+		if got := r.URL.Query().Get("active"); got != "true" {
+			t.Errorf("unexpected active query %q", got)
+		}
+
+		writeJSON(t, w, []map[string]interface{}{
+			{
+				"labels":      map[string]string{"alertname": "first"},
+				"annotations": map[string]string{},
+				"startsAt":    "2021-11-01T00:00:00Z",
+				"fingerprint": "1",
+				"receivers":   []map[string]string{{"name": "tg--100"}},
+				"status":      map[string]interface{}{"state": "active"},
+			},
+			{
+				"labels":      map[string]string{"alertname": "second"},
+				"startsAt":    "2021-11-01T00:00:00Z",
+				"fingerprint": "2",
+				"receivers":   []map[string]string{{"name": "other"}},
+				"status":      map[string]interface{}{"state": "active"},
+			},
+		})
+	}))
+
+	alerts, err := a.ListAlerts("tg--100", map[string]string{"active": "true"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 alert, got %d", len(alerts))
+	}
+	if name := alerts[0].Labels[model.AlertNameLabel]; name != "first" {
+		t.Errorf("unexpected alert %s", name)
+	}
+}
+
+func TestListAlertGroups(t *testing.T) {
+	a := newTestAlertmanager(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts/groups" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		writeJSON(t, w, []map[string]interface{}{
+			{
+				"labels":   map[string]string{"alertname": "first"},
+				"receiver": map[string]string{"name": "tg--100"},
+				"alerts": []map[string]interface{}{
+					{"labels": map[string]string{"alertname": "first"}, "fingerprint": "1"},
+					{"labels": map[string]string{"alertname": "first"}, "fingerprint": "2"},
+				},
+			},
+			{
+				"labels":   map[string]string{"alertname": "second"},
+				"receiver": map[string]string{"name": "other"},
+				"alerts":   []map[string]interface{}{{"labels": map[string]string{"alertname": "second"}}},
+			},
+		})
+	}))
+
+	groups, err := a.ListAlertGroups("tg--100", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(groups))
+	}
+	if n := len(groups[0].ModelAlerts()); n != 2 {
+		t.Errorf("expected 2 alerts in group, got %d", n)
+	}
+}
+
+func TestListAlertsError(t *testing.T) {
+	a := newTestAlertmanager(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	}))
+
+	_, err := a.ListAlerts("tg--100", nil)
+	if err == nil || !strings.Contains(err.Error(), "500") || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("expected error with status and body, got %v", err)
+	}
+}
+
+func TestSilences(t *testing.T) {
+	var created Silence
+	var expired string
+	a := newTestAlertmanager(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v2/silences":
+			if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("unexpected content type %q", ct)
+			}
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				t.Errorf("failed to decode silence: %s", err)
+			}
+			writeJSON(t, w, map[string]string{"silenceID": "new"})
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/silences":
+			now := time.Now()
+			writeJSON(t, w, []Silence{
+				{ID: "late", EndsAt: now.Add(2 * time.Hour), Status: &SilenceStatus{State: "active"}},
+				{ID: "expired", EndsAt: now.Add(-time.Hour), Status: &SilenceStatus{State: "expired"}},
+				{ID: "early", EndsAt: now.Add(time.Hour), Status: &SilenceStatus{State: "pending"}},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/api/v2/silence/a b":
+			writeJSON(t, w, Silence{ID: "a b", Status: &SilenceStatus{State: "active"}})
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v2/silence/"):
+			expired = strings.TrimPrefix(r.URL.Path, "/api/v2/silence/")
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+
+	ms, err := MatchersFromLabels(model.LabelSet{"alertname": "test", "instance": "host:9100"})
+	if err != nil {
+		t.Fatalf("failed to create matchers: %s", err)
+	}
+	id, err := a.CreateSilence(NewSilence(ms, time.Hour, "user", "comment"))
+	if err != nil {
+		t.Fatalf("failed to create silence: %s", err)
+	}
+	if id != "new" {
+		t.Errorf("unexpected silence id %q", id)
+	}
+	if len(created.Matchers) != 2 || !created.Matchers[0].IsEqual || created.Matchers[0].IsRegex {
+		t.Errorf("unexpected silence matchers %+v", created.Matchers)
+	}
+	if d := created.EndsAt.Sub(created.StartsAt); d != time.Hour {
+		t.Errorf("unexpected silence duration %s", d)
+	}
+
+	silences, err := a.ListSilences()
+	if err != nil {
+		t.Fatalf("failed to list silences: %s", err)
+	}
+	if len(silences) != 2 || silences[0].ID != "early" || silences[1].ID != "late" {
+		t.Errorf("expected actual silences sorted by end, got %+v", silences)
+	}
+
+	s, err := a.GetSilence("a b")
+	if err != nil {
+		t.Fatalf("failed to get silence: %s", err)
+	}
+	if s.ID != "a b" || !s.IsActual() {
+		t.Errorf("unexpected silence %+v", s)
+	}
+
+	if err := a.ExpireSilence("a b"); err != nil {
+		t.Fatalf("failed to expire silence: %s", err)
+	}
+	if expired != "a b" {
+		t.Errorf("unexpected expired silence %q", expired)
+	}
+}
+
+func TestMatchersFromLabelsInvalid(t *testing.T) {
+	tests := []model.LabelSet{
+		{"invalid-name": "value"},
+		{"alertname": "test", "instance": "\xff"},
+	}
+
+	for _, ls := range tests {
+		if ms, err := MatchersFromLabels(ls); err == nil {
+			t.Errorf("expected error for %v, got matchers %v", ls, ms)
+		}
+	}
+}
+
+func TestMatcherString(t *testing.T) {
+	tests := []struct {
+		typ  labels.MatchType
+		want string
+	}{
+		{labels.MatchEqual, `job="node"`},
+		{labels.MatchNotEqual, `job!="node"`},
+		{labels.MatchRegexp, `job=~"node"`},
+		{labels.MatchNotRegexp, `job!~"node"`},
+	}
+
+	for _, tt := range tests {
+		m, err := labels.NewMatcher(tt.typ, "job", "node")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := NewSilence([]*labels.Matcher{m}, time.Hour, "", "")
+		if got := s.Matchers[0].String(); got != tt.want {
+			t.Errorf("expected %s, got %s", tt.want, got)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	status := http.StatusOK
+	a := newTestAlertmanager(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/-/reload" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, "bad config")
+	}))
+
+	if err := a.Reload(); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	status = http.StatusInternalServerError
+	err := a.Reload()
+	var re *ReloadError
+	if !errors.As(err, &re) || re.StatusCode != status || re.Body != "bad config" {
+		t.Errorf("expected reload error with body, got %v", err)
+	}
+}
+
+func TestReloadUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	path := filepath.Join(t.TempDir(), "alertmanager.yml")
+	a, err := New(srv.URL, "http://bot/webhook", "", config.NewFileStorage(path), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.Reload()
+	var re *ReloadError
+	if err == nil || errors.As(err, &re) {
+		t.Errorf("expected network error, got %v", err)
+	}
+}
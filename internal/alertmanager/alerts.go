@@ -5,25 +5,39 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"regexp"
+	"time"
 
 	"github.com/prometheus/common/model"
 )
 
-type alertResponse struct {
-	Alerts []*AlertsData `json:"data,omitempty"`
+type AlertStatus struct {
+	State       string   `json:"state"`
+	SilencedBy  []string `json:"silencedBy"`
+	InhibitedBy []string `json:"inhibitedBy"`
 }
 
 type AlertsData struct {
 	model.Alert
 
-	Receivers *Receivers `json:"receivers"`
+	Fingerprint string      `json:"fingerprint"`
+	UpdatedAt   time.Time   `json:"updatedAt"`
+	Receivers   Receivers   `json:"receivers"`
+	Status      AlertStatus `json:"status"`
 }
 
-type Receivers []string
+type AlertGroup struct {
+	Labels   model.LabelSet `json:"labels"`
+	Receiver Receiver       `json:"receiver"`
+	Alerts   []*AlertsData  `json:"alerts"`
+}
+
+type Receivers []Receiver
 
 func (r *Receivers) contains(receiver string) bool {
 	for _, value := range *r {
-		if value == receiver {
+		if value.Name == receiver {
 			return true
 		}
 	}
@@ -33,63 +47,112 @@ func (r *Receivers) contains(receiver string) bool {
 
 // ListAlerts returns a slice of Alert and an error.
 func (a *Alertmanager) ListAlerts(receiver string, params map[string]string) ([]*model.Alert, error) {
-	req, err := http.NewRequest(
-		http.MethodGet,
-		fmt.Sprintf("%s/api/v1/alerts", a.url),
-		nil,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed make request obj: %s", err)
+	var data []*AlertsData
+	if err := a.do(http.MethodGet, "/alerts", receiverQuery(receiver, params), nil, &data); err != nil {
+		return nil, err
 	}
 
-	query := req.URL.Query()
-	for key, value := range params {
-		query.Add(key, value)
+	var alerts []*model.Alert
+	for _, value := range data {
+		if value.Receivers.contains(receiver) {
+			alerts = append(alerts, value.toModel())
+		}
 	}
-	req.URL.RawQuery = query.Encode()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed make request: %s", err)
-	}
+	return alerts, nil
+}
 
-	var alertResponse alertResponse
-	dec := json.NewDecoder(resp.Body)
-	defer resp.Body.Close()
-	if err := dec.Decode(&alertResponse); err != nil {
+// ListAlertGroups returns alert groups routed to given receiver.
+func (a *Alertmanager) ListAlertGroups(receiver string, params map[string]string) ([]*AlertGroup, error) {
+	var data []*AlertGroup
+	if err := a.do(http.MethodGet, "/alerts/groups", receiverQuery(receiver, params), nil, &data); err != nil {
 		return nil, err
 	}
 
-	var alerts []*model.Alert
-	for _, value := range alertResponse.Alerts {
-		if value.Receivers.contains(receiver) {
-			alert := &model.Alert{
-				Labels:       value.Labels,
-				Annotations:  value.Annotations,
-				StartsAt:     value.StartsAt,
-				EndsAt:       value.EndsAt,
-				GeneratorURL: value.GeneratorURL,
-			}
-			alerts = append(alerts, alert)
+	var groups []*AlertGroup
+	for _, value := range data {
+		if value.Receiver.Name == receiver {
+			groups = append(groups, value)
 		}
 	}
 
-	return alerts, err
+	return groups, nil
+}
+
+func (d *AlertsData) toModel() *model.Alert {
+	return &model.Alert{
+		Labels:       d.Labels,
+		Annotations:  d.Annotations,
+		StartsAt:     d.StartsAt,
+		EndsAt:       d.EndsAt,
+		GeneratorURL: d.GeneratorURL,
+	}
+}
+
+// ModelAlerts returns group alerts converted to prometheus model.
+func (g *AlertGroup) ModelAlerts() []*model.Alert {
+	out := make([]*model.Alert, 0, len(g.Alerts))
+	for _, value := range g.Alerts {
+		out = append(out, value.toModel())
+	}
+
+	return out
+}
+
+func receiverQuery(receiver string, params map[string]string) url.Values {
+	query := url.Values{}
+	for key, value := range params {
+		query.Add(key, value)
+	}
+	if receiver != "" {
+		query.Set("receiver", regexp.QuoteMeta(receiver))
+	}
+
+	return query
+}
+
+// Webhook is alertmanager webhook message of version 4
+type Webhook struct {
+	Data
+
+	Version string `json:"version"`
 }
 
-type alertWebhook struct {
-	Receiver string         `json:"receiver"`
-	Alerts   []*model.Alert `json:"alerts,omitempty"`
+// IsResolved returns true if all webhook alerts are resolved
+func (w *Webhook) IsResolved() bool {
+	return w.Status == string(model.AlertResolved)
+}
+
+// ModelAlerts returns webhook alerts converted to prometheus model.
+func (w *Webhook) ModelAlerts() []*model.Alert {
+	out := make([]*model.Alert, 0, len(w.Alerts))
+	for _, value := range w.Alerts {
+		alert := &model.Alert{
+			Labels:       make(model.LabelSet, len(value.Labels)),
+			Annotations:  make(model.LabelSet, len(value.Annotations)),
+			StartsAt:     value.StartsAt,
+			EndsAt:       value.EndsAt,
+			GeneratorURL: value.GeneratorURL,
+		}
+		for k, v := range value.Labels {
+			alert.Labels[model.LabelName(k)] = model.LabelValue(v)
+		}
+		for k, v := range value.Annotations {
+			alert.Annotations[model.LabelName(k)] = model.LabelValue(v)
+		}
+		out = append(out, alert)
+	}
+
+	return out
 }
 
-func GetWebhookData(r *http.Request) ([]*model.Alert, string, error) {
-	var alertWebhook alertWebhook
+func GetWebhookData(r *http.Request) (*Webhook, error) {
+	var webhook Webhook
 
 	dec := json.NewDecoder(r.Body)
-	if err := dec.Decode(&alertWebhook); err != nil {
-		return nil, "", fmt.Errorf("failed read webhook request body: %s", err)
+	if err := dec.Decode(&webhook); err != nil {
+		return nil, fmt.Errorf("failed read webhook request body: %s", err)
 	}
 
-	return alertWebhook.Alerts, alertWebhook.Receiver, nil
+	return &webhook, nil
 }
@@ -0,0 +1,121 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// alertmanager api v2 is available since alertmanager v0.16.0,
+// v1 api was removed in v0.27.0
+const apiPrefix = "/api/v2"
+
+type Receiver struct {
+	Name string `json:"name"`
+}
+
+type VersionInfo struct {
+	Branch    string `json:"branch"`
+	BuildDate string `json:"buildDate"`
+	BuildUser string `json:"buildUser"`
+	GoVersion string `json:"goVersion"`
+	Revision  string `json:"revision"`
+	Version   string `json:"version"`
+}
+
+type PeerStatus struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+}
+
+type ClusterStatus struct {
+	Name   string       `json:"name"`
+	Status string       `json:"status"`
+	Peers  []PeerStatus `json:"peers"`
+}
+
+type Status struct {
+	Cluster     ClusterStatus `json:"cluster"`
+	VersionInfo VersionInfo   `json:"versionInfo"`
+	Config      struct {
+		Original string `json:"original"`
+	} `json:"config"`
+	Uptime time.Time `json:"uptime"`
+}
+
+// GetStatus returns alertmanager status.
+func (a *Alertmanager) GetStatus() (*Status, error) {
+	var status Status
+	if err := a.do(http.MethodGet, "/status", nil, nil, &status); err != nil {
+		return nil, err
+	}
+
+	return &status, nil
+}
+
+// ListReceivers returns receivers names known by alertmanager.
+func (a *Alertmanager) ListReceivers() ([]string, error) {
+	var receivers []Receiver
+	if err := a.do(http.MethodGet, "/receivers", nil, nil, &receivers); err != nil {
+		return nil, err
+	}
+
+	out := make([]string, 0, len(receivers))
+	for _, r := range receivers {
+		out = append(out, r.Name)
+	}
+
+	return out, nil
+}
+
+// do makes request to alertmanager api and decodes response body into out
+func (a *Alertmanager) do(method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed marshal request body: %s", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("%s%s%s", a.url, apiPrefix, path), body)
+	if err != nil {
+		return fmt.Errorf("failed make request obj: %s", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if query != nil {
+		req.URL.RawQuery = query.Encode()
+	}
+
+	resp, err := a.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed make request: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("response body read failed: %s", err)
+		}
+
+		return fmt.Errorf("failed %s %s with status code \"%d\" and body \"%s\"", method, path, resp.StatusCode, data)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed read response body: %s", err)
+	}
+
+	return nil
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
-	"context"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"log"
@@ -11,23 +13,42 @@ import (
 	"sync"
 
 	amcfg "github.com/prometheus/alertmanager/config"
-	"k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/types"
-	"sigs.k8s.io/controller-runtime/pkg/client"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"k8s.io/client-go/util/retry"
 )
 
 var (
-	ErrNotFound = errors.New("not found")
+	ErrNotFound   = errors.New("not found")
+	ErrNoRevision = errors.New("previous config revision is unknown or outdated")
+	// ErrSubscribedToAll is returned on adding route to receiver, which has catch-all route
+	ErrSubscribedToAll = errors.New("receiver is subscribed to all alerts")
+
+	// errNotChanged is returned by mutation, when config shouldn't be written
+	errNotChanged = errors.New("not changed")
 )
 
 type Config struct {
-	kd, km *types.NamespacedName
-	wh     []*amcfg.WebhookConfig
-	kc     client.Client
-	mux    *sync.Mutex
+	dest, manual Storage
+	wh           []*amcfg.WebhookConfig
+	mux          *sync.Mutex
+}
+
+// Change describes config revision written by bot
+type Change struct {
+	// short hashes of replaced and written configs
+	Before, After string
+
+	// replaced and written configs, kept to rollback config rejected by alertmanager
+	prev, cur []byte
+}
+
+func newChange(prev, cur []byte) *Change {
+	return &Change{Before: hash(prev), After: hash(cur), prev: prev, cur: cur}
 }
 
-func New(kd, km *types.NamespacedName, wu *url.URL, kc client.Client) *Config {
+// New returns config manager, which keeps bot receivers and routes in dest storage,
+// manual storage is optional and contains predefined user config
+func New(dest, manual Storage, wu *url.URL) *Config {
 	wc := &amcfg.WebhookConfig{
 		NotifierConfig: amcfg.NotifierConfig{
 			VSendResolved: true,
@@ -39,61 +60,83 @@ func New(kd, km *types.NamespacedName, wu *url.URL, kc client.Client) *Config {
 	wh := []*amcfg.WebhookConfig{wc}
 
 	return &Config{
-		kd:  kd,
-		km:  km,
-		wh:  wh,
-		kc:  kc,
-		mux: &sync.Mutex{},
+		dest:   dest,
+		manual: manual,
+		wh:     wh,
+		mux:    &sync.Mutex{},
 	}
 }
 
-func (c *Config) RegisterReceiver(receiver int64) error {
-	conf, err := c.Get()
-	if err != nil {
-		return fmt.Errorf("failed to get alertmanager config from specified secret: %s", err)
-	}
-
-	c.mux.Lock()
-	defer c.mux.Unlock()
+func (c *Config) RegisterReceiver(receiver int64) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		return c.addReceiver(conf, receiver)
+	})
+}
 
-	err = c.addReceiver(conf, receiver)
-	if err != nil {
-		return fmt.Errorf("failed to add receiver: %s", err)
-	}
+func (c *Config) DisableReceiver(receiver int64) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		r := botReceiverName(receiver)
+		br := botRoute(conf)
+		br.Routes = removeAllRoutes(br.Routes, r)
 
-	err = c.write(conf)
-	if err != nil {
-		return fmt.Errorf("failed to save alertmanger config: %s", err)
-	}
+		p := getReceiverPosition(conf.Receivers, r)
+		if p == -1 {
+			return ErrNotFound
+		}
+		conf.Receivers[p] = conf.Receivers[len(conf.Receivers)-1]
+		conf.Receivers = conf.Receivers[:len(conf.Receivers)-1]
+		conf.MuteTimeIntervals = removeQuietHours(conf.MuteTimeIntervals, receiver)
 
-	return nil
+		return nil
+	})
 }
 
-func (c *Config) DisableReceiver(receiver int64) error {
-	conf, err := c.Get()
-	if err != nil {
-		return fmt.Errorf("failed to get alertmanager config from specified secret: %s", err)
-	}
+// MigrateReceiver moves receiver with its routes and quiet hours to another chat id,
+// it is used when telegram group is upgraded to supergroup
+func (c *Config) MigrateReceiver(from, to int64) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		rf, rt := botReceiverName(from), botReceiverName(to)
 
-	c.mux.Lock()
-	defer c.mux.Unlock()
+		p := getReceiverPosition(conf.Receivers, rf)
+		if p == -1 {
+			return ErrNotFound
+		}
+		// target chat may be registered already, its receiver and quiet hours are kept then
+		if getReceiverPosition(conf.Receivers, rt) == -1 {
+			conf.Receivers[p].Name = rt
+			for i, mt := range conf.MuteTimeIntervals {
+				if quietHoursReceiver(mt.Name) == rf {
+					conf.MuteTimeIntervals[i].Name = rt + strings.TrimPrefix(mt.Name, rf)
+				}
+			}
+		} else {
+			conf.Receivers = append(conf.Receivers[:p], conf.Receivers[p+1:]...)
+			conf.MuteTimeIntervals = removeQuietHours(conf.MuteTimeIntervals, from)
+		}
 
-	r := strconv.FormatInt(receiver, 10)
-	conf.Route.Routes = removeAllRoutes(conf.Route.Routes, r)
+		br := botRoute(conf)
+		var routes []*amcfg.Route
+		for _, r := range br.Routes {
+			if r.Receiver != rf {
+				routes = append(routes, r)
 
-	p := getReceiverPosition(conf.Receivers, r)
-	if p == -1 {
-		return ErrNotFound
-	}
-	conf.Receivers[p] = conf.Receivers[len(conf.Receivers)-1]
-	conf.Receivers = conf.Receivers[:len(conf.Receivers)-1]
+				continue
+			}
 
-	err = c.write(conf)
-	if err != nil {
-		return fmt.Errorf("failed to save alertmanger config: %s", err)
-	}
+			// subscriptions, which exist in target chat already, are dropped
+			if getRoutePositionByName(br.Routes, rt, RouteName(r)) != -1 {
+				continue
+			}
 
-	return nil
+			r.Receiver = rt
+			applyQuietHours(r, "")
+			inheritQuietHours(conf, r)
+			routes = append(routes, r)
+		}
+		br.Routes = routes
+
+		return nil
+	})
 }
 
 func (c *Config) IsReceiverExists(receiver int64) (bool, error) {
@@ -102,8 +145,7 @@ func (c *Config) IsReceiverExists(receiver int64) (bool, error) {
 		return false, fmt.Errorf("failed to get alertmanager config from specified secret: %s", err)
 	}
 
-	r := strconv.FormatInt(receiver, 10)
-	if p := getReceiverPosition(conf.Receivers, r); p == -1 {
+	if p := getReceiverPosition(conf.Receivers, botReceiverName(receiver)); p == -1 {
 		return false, nil
 	}
 
@@ -116,181 +158,442 @@ func (c *Config) IsRouteExists(receiver int64, match map[string]string) (bool, e
 		return false, fmt.Errorf("failed to get alertmanager config from specified secret: %s", err)
 	}
 
-	r := strconv.FormatInt(receiver, 10)
-	if p := getRoutePosition(conf.Route.Routes, r, match); p == -1 {
+	if p := getRoutePosition(botRoute(conf).Routes, botReceiverName(receiver), match); p == -1 {
 		return false, nil
 	}
 
 	return true, nil
 }
 
-func (c *Config) AddRoute(receiver int64, match map[string]string) error {
+// Routes returns routes of given receiver
+func (c *Config) Routes(receiver int64) ([]*amcfg.Route, error) {
 	conf, err := c.Get()
 	if err != nil {
-		return fmt.Errorf("failed to get alertmanager config from specified secret: %s", err)
+		return nil, fmt.Errorf("failed to get alertmanager config from specified secret: %s", err)
 	}
 
-	c.mux.Lock()
-	defer c.mux.Unlock()
+	var out []*amcfg.Route
+	r := botReceiverName(receiver)
+	for _, value := range botRoute(conf).Routes {
+		if value.Receiver == r {
+			out = append(out, value)
+		}
+	}
 
-	r := strconv.FormatInt(receiver, 10)
-	p := getRoutePosition(conf.Route.Routes, r, match)
-	if p != -1 {
-		log.Printf("route %s with match %v already exists", r, match)
+	return out, nil
+}
 
-		return nil
-	}
+func (c *Config) AddRoute(receiver int64, match map[string]string) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		r := botReceiverName(receiver)
+		br := botRoute(conf)
+		p := getRoutePosition(br.Routes, r, match)
+		if p != -1 {
+			log.Printf("route %s with match %v already exists", r, match)
 
-	if match == nil {
-		conf.Route.Routes = removeAllRoutes(conf.Route.Routes, r)
-	}
+			return errNotChanged
+		}
 
-	route := &amcfg.Route{
-		Receiver: r,
-		Continue: true,
-		Match:    match,
-	}
+		if match == nil {
+			br.Routes = removeAllRoutes(br.Routes, r)
+		} else if getRoutePosition(br.Routes, r, nil) != -1 {
+			return ErrSubscribedToAll
+		}
 
-	conf.Route.Routes = append(conf.Route.Routes, route)
+		route := &amcfg.Route{
+			Receiver: r,
+			Continue: true,
+			Match:    match,
+		}
+		inheritSettings(br.Routes, route)
+		inheritQuietHours(conf, route)
 
-	err = c.write(conf)
-	if err != nil {
-		return fmt.Errorf("failed to save alertmanger config: %s", err)
-	}
+		br.Routes = append(br.Routes, route)
 
-	return nil
+		return nil
+	})
 }
 
-func (c *Config) RemoveRoute(receiver int64, match map[string]string) error {
-	conf, err := c.Get()
-	if err != nil {
-		return fmt.Errorf("failed to get alertmanager config from specified secret: %s", err)
-	}
+func (c *Config) RemoveRoute(receiver int64, match map[string]string) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		r := botReceiverName(receiver)
+		br := botRoute(conf)
+		p := getRoutePosition(br.Routes, r, match)
+		if p == -1 {
+			log.Printf("route %s with match %v doesn't exists", r, match)
 
-	c.mux.Lock()
-	defer c.mux.Unlock()
+			return errNotChanged
+		}
 
-	r := strconv.FormatInt(receiver, 10)
-	p := getRoutePosition(conf.Route.Routes, r, match)
-	if p == -1 {
-		log.Printf("route %s with match %v doesn't exists", r, match)
+		br.Routes[p] = br.Routes[len(br.Routes)-1]
+		br.Routes = br.Routes[:len(br.Routes)-1]
 
 		return nil
-	}
+	})
+}
 
-	conf.Route.Routes[p] = conf.Route.Routes[len(conf.Route.Routes)-1]
-	conf.Route.Routes = conf.Route.Routes[:len(conf.Route.Routes)-1]
+// AddMatchersRoute adds routes with given matchers sets for receiver,
+// all routes are added by single config change
+func (c *Config) AddMatchersRoute(receiver int64, matchers ...amcfg.Matchers) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		r := botReceiverName(receiver)
+		br := botRoute(conf)
+		if getRoutePosition(br.Routes, r, nil) != -1 {
+			return ErrSubscribedToAll
+		}
 
-	err = c.write(conf)
-	if err != nil {
-		return fmt.Errorf("failed to save alertmanger config: %s", err)
-	}
+		var added bool
+		for _, ms := range matchers {
+			route := &amcfg.Route{
+				Receiver: r,
+				Continue: true,
+				Matchers: ms,
+			}
+
+			name := RouteName(route)
+			if p := getRoutePositionByName(br.Routes, r, name); p != -1 {
+				log.Printf("route %s with matchers %s already exists", r, name)
+
+				continue
+			}
+			inheritSettings(br.Routes, route)
+			inheritQuietHours(conf, route)
+
+			br.Routes = append(br.Routes, route)
+			added = true
+		}
 
-	return nil
+		if !added {
+			return errNotChanged
+		}
+
+		return nil
+	})
 }
 
-func (c *Config) FindMatchByPrefix(receiver int64, prefix string) (map[string]string, error) {
+// Receivers returns receivers, which have routes
+func (c *Config) Receivers() ([]int64, error) {
 	conf, err := c.Get()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get alertmanager config from specified secret: %s", err)
 	}
 
-	c.mux.Lock()
-	defer c.mux.Unlock()
+	br := findBotRoute(conf)
+	if br == nil {
+		return nil, nil
+	}
 
-	r := strconv.FormatInt(receiver, 10)
-	routes := listRoutes(conf.Route.Routes, r)
-	for _, value := range routes {
-		if group, ok := value.match["alertgroup"]; ok && strings.HasPrefix(group, prefix) {
-			return value.match, nil
+	var out []int64
+	seen := make(map[int64]bool)
+	for _, r := range br.Routes {
+		receiver, err := strconv.ParseInt(strings.TrimPrefix(r.Receiver, ReceiverPrefix), 10, 64)
+		if err != nil || !isBotReceiver(r.Receiver) || seen[receiver] {
+			continue
 		}
+		seen[receiver] = true
+		out = append(out, receiver)
 	}
 
-	return nil, ErrNotFound
+	return out, nil
+}
+
+// RestrictRoutes checks every receiver route with given function, which returns true
+// for allowed routes or matchers sets replacing not allowed route otherwise.
+// Route is removed, if no sets are returned for it.
+func (c *Config) RestrictRoutes(receiver int64, restrict func(ms labels.Matchers) ([]labels.Matchers, bool)) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		r := botReceiverName(receiver)
+		br := botRoute(conf)
+
+		var changed bool
+		routes := make([]*amcfg.Route, 0, len(br.Routes))
+		var added []*amcfg.Route
+		for _, route := range br.Routes {
+			if route.Receiver != r {
+				routes = append(routes, route)
+
+				continue
+			}
+
+			sets, ok := restrict(routeMatchers(route))
+			if ok {
+				routes = append(routes, route)
+
+				continue
+			}
+			changed = true
+
+			for _, ms := range sets {
+				nr := &amcfg.Route{
+					Receiver: r,
+					Continue: true,
+					Matchers: amcfg.Matchers(ms),
+				}
+				// notification settings of replaced route are kept
+				inheritSettings([]*amcfg.Route{route}, nr)
+				inheritQuietHours(conf, nr)
+
+				added = append(added, nr)
+			}
+		}
+
+		if !changed {
+			return errNotChanged
+		}
+
+		br.Routes = routes
+		for _, route := range added {
+			if getRoutePositionByName(br.Routes, r, RouteName(route)) == -1 {
+				br.Routes = append(br.Routes, route)
+			}
+		}
+
+		return nil
+	})
+}
+
+// RemoveRouteByName removes receiver route with given name
+func (c *Config) RemoveRouteByName(receiver int64, name string) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		r := botReceiverName(receiver)
+		br := botRoute(conf)
+		p := getRoutePositionByName(br.Routes, r, name)
+		if p == -1 {
+			log.Printf("route %s with name %s doesn't exists", r, name)
+
+			return errNotChanged
+		}
+
+		br.Routes = append(br.Routes[:p], br.Routes[p+1:]...)
+
+		return nil
+	})
 }
 
 func (c *Config) Get() (*amcfg.Config, error) {
-	sd, err := c.getSecret(c.kd)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get secret with alertmanager config: %s", err)
+	_, _, _, conf, err := c.load()
+
+	return conf, err
+}
+
+// ReceiverName returns name of receiver in alertmanager config
+func (c *Config) ReceiverName(receiver int64) string {
+	if n, ok := c.dest.(receiverNamer); ok {
+		return n.ReceiverName(strconv.FormatInt(receiver, 10))
+	}
+
+	return botReceiverName(receiver)
+}
+
+// ParseReceiverName returns receiver with given name in alertmanager config
+func (c *Config) ParseReceiverName(name string) (int64, error) {
+	if n, ok := c.dest.(receiverNamer); ok {
+		r, ok := n.ParseReceiverName(name)
+		if !ok {
+			return 0, fmt.Errorf("receiver %s isn't managed by bot", name)
+		}
+
+		return strconv.ParseInt(r, 10, 64)
 	}
 
-	conf, err := amcfg.Load(string(sd.Data["alertmanager.yaml"]))
+	// receivers without prefix are created by previous bot versions
+	return strconv.ParseInt(strings.TrimPrefix(name, ReceiverPrefix), 10, 64)
+}
+
+// SelfReloading returns true, if config changes are applied
+// to alertmanager without reload by bot
+func (c *Config) SelfReloading() bool {
+	r, ok := c.dest.(selfReloader)
+
+	return ok && r.SelfReloading()
+}
+
+// QuietHoursSupported returns false, if config storage can't keep quiet hours
+func (c *Config) QuietHoursSupported() bool {
+	l, ok := c.dest.(quietHoursLimiter)
+
+	return !ok || l.QuietHoursSupported()
+}
+
+func (c *Config) Sync() error {
+	_, err := c.update(func(conf *amcfg.Config) error {
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed unmarshal alertmanager.yaml file: %s", err)
+		return fmt.Errorf("failed to sync alertmanager configs: %s", err)
 	}
 
-	if c.km != nil {
-		sm, err := c.getSecret(c.km)
+	return nil
+}
+
+// update applies given mutation to actual config and saves it. Config is written
+// only if it wasn't changed since reading, so mutation is repeated on write conflicts,
+// which are caused by concurrent changes from other goroutines or bot replicas.
+// Written revision is returned, nil change means that config isn't changed.
+func (c *Config) update(mutate func(conf *amcfg.Config) error) (*Change, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	var change *Change
+	err := retry.OnError(retry.DefaultRetry, isConflict, func() error {
+		prev, revision, base, conf, err := c.load()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get secret with alertmanager config: %s", err)
+			return err
 		}
 
-		cm, err := amcfg.Load(string(sm.Data["alertmanager.yaml"]))
+		if err := mutate(conf); err != nil {
+			return err
+		}
+
+		data, err := render(base, conf)
 		if err != nil {
-			return nil, fmt.Errorf("failed unmarshal alertmanager.yaml file: %s", err)
+			return err
+		}
+
+		if err := validate(conf, data); err != nil {
+			return err
 		}
 
-		cm.Route.Routes = conf.Route.Routes
-		cm.Receivers = conf.Receivers
+		if data == string(prev) {
+			return errNotChanged
+		}
 
-		return cm, nil
+		if err := c.dest.Write([]byte(data), revision); err != nil {
+			return err
+		}
+		change = newChange(prev, []byte(data))
+
+		return nil
+	})
+	if err == errNotChanged {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	return conf, nil
+	return change, nil
 }
 
-func (c *Config) Sync() error {
-	conf, err := c.Get()
+// load returns destination config data with its revision, base data for rendering
+// and config, merged with manual one if it is specified. Base data is manual config
+// data if it is specified and destination config data otherwise.
+func (c *Config) load() ([]byte, string, []byte, *amcfg.Config, error) {
+	data, revision, err := c.dest.Read()
 	if err != nil {
-		return fmt.Errorf("failed to sync alertmanager configs: %s", err)
+		return nil, "", nil, nil, err
 	}
 
-	return c.write(conf)
-}
-
-func (c *Config) getSecret(key *types.NamespacedName) (*v1.Secret, error) {
-	s := &v1.Secret{}
+	conf, err := amcfg.Load(string(data))
+	if err != nil {
+		return nil, "", nil, nil, fmt.Errorf("failed unmarshal alertmanager.yaml file: %s", err)
+	}
 
-	if err := c.kc.Get(context.Background(), *key, s); err != nil {
-		return nil, err
+	if migrate(conf, c.webhookURL()) {
+		log.Printf("bot receivers and routes of previous version are migrated")
 	}
 
-	if _, ok := s.Data["alertmanager.yaml"]; !ok {
-		return nil, fmt.Errorf("secret not contain alertmanager.yaml file")
+	if c.manual != nil {
+		md, _, err := c.manual.Read()
+		if err != nil {
+			return nil, "", nil, nil, err
+		}
+
+		cm, err := amcfg.Load(string(md))
+		if err != nil {
+			return nil, "", nil, nil, fmt.Errorf("failed unmarshal alertmanager.yaml file: %s", err)
+		}
+
+		merged, err := merge(conf, cm)
+		if err != nil {
+			return nil, "", nil, nil, fmt.Errorf("failed to merge manual config: %s", err)
+		}
+
+		return data, revision, md, merged, nil
 	}
 
-	return s, nil
+	return data, revision, data, conf, nil
 }
 
-func (c *Config) write(conf *amcfg.Config) error {
-	s, err := c.getSecret(c.kd)
-	if err != nil {
-		return fmt.Errorf("failed to get secret with alertmanager config: %s", err)
+// Rollback restores config revision, which was replaced by given change.
+// Config isn't restored, if it was changed by someone else since then.
+func (c *Config) Rollback(change *Change) (*Change, error) {
+	if change == nil {
+		return nil, ErrNoRevision
 	}
 
-	data := conf.String()
-	s.Data["alertmanager.yaml"] = []byte(data)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	err := retry.OnError(retry.DefaultRetry, isConflict, func() error {
+		data, revision, err := c.dest.Read()
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(data, change.cur) {
+			return ErrNoRevision
+		}
 
-	err = c.kc.Update(context.Background(), s)
+		return c.dest.Write(change.prev, revision)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to update alertmanager secret with config: %s", err)
+		return nil, fmt.Errorf("failed to restore previous alertmanager config: %s", err)
 	}
 
-	return nil
+	return newChange(change.cur, change.prev), nil
 }
 
 func (c *Config) addReceiver(conf *amcfg.Config, receiver int64) error {
-	r := strconv.FormatInt(receiver, 10)
+	r := botReceiverName(receiver)
+
+	// receivers must not share webhook configs, which may be changed per receiver
+	wh := make([]*amcfg.WebhookConfig, 0, len(c.wh))
+	for _, value := range c.wh {
+		v := *value
+		// alertmanager sets global http config for webhooks on load,
+		// so repeated registration doesn't change rendered config
+		if v.HTTPConfig == nil && conf.Global != nil {
+			v.HTTPConfig = conf.Global.HTTPConfig
+		}
+		wh = append(wh, &v)
+	}
+
 	if pos := getReceiverPosition(conf.Receivers, r); pos == -1 {
 		rc := &amcfg.Receiver{
 			Name:           r,
-			WebhookConfigs: c.wh,
+			WebhookConfigs: wh,
 		}
 		conf.Receivers = append(conf.Receivers, rc)
+	} else if rc := conf.Receivers[pos]; len(rc.WebhookConfigs) == 0 {
+		rc.WebhookConfigs = wh
 	} else {
-		conf.Receivers[pos].WebhookConfigs = c.wh
+		// settings of registered receiver, like send_resolved, are kept
+		for i, value := range rc.WebhookConfigs {
+			v := *value
+			v.URL = c.wh[0].URL
+			rc.WebhookConfigs[i] = &v
+		}
 	}
 
 	return nil
 }
+
+// webhookURL returns url of bot webhook
+func (c *Config) webhookURL() string {
+	if c.wh[0].URL == nil || c.wh[0].URL.URL == nil {
+		return ""
+	}
+
+	return c.wh[0].URL.String()
+}
+
+// hash returns short hash of config data
+func hash(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:6])
+}
+
+func isConflict(err error) bool {
+	return err == ErrConflict
+}
@@ -0,0 +1,595 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+
+	amcfg "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/timeinterval"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newReplicas returns configs sharing one secret storage, like bot replicas do
+func newReplicas(t *testing.T, n int) []*Config {
+	t.Helper()
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "alertmanager"},
+		Data:       map[string][]byte{ConfigKey: []byte(testDestConfig)},
+	}
+	kc := fake.NewClientBuilder().WithObjects(secret).Build()
+
+	wu, _ := url.Parse("http://bot:8000/webhook")
+	out := make([]*Config, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, New(NewSecretStorage("monitoring", "alertmanager", kc), nil, wu))
+	}
+
+	return out
+}
+
+func parallel(n int, f func(i int) error) []error {
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = f(i)
+		}(i)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+func TestUpdateParallelReplicas(t *testing.T) {
+	replicas := newReplicas(t, 4)
+
+	errs := parallel(len(replicas), func(i int) error {
+		_, err := replicas[i].RegisterReceiver(int64(100 + i))
+
+		return err
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("replica %d failed to register receiver: %s", i, err)
+		}
+	}
+
+	conf, err := replicas[0].Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range replicas {
+		if getReceiverPosition(conf.Receivers, botReceiverName(int64(100+i))) == -1 {
+			t.Errorf("receiver of replica %d is lost", i)
+		}
+	}
+}
+
+func TestUpdateParallelGoroutines(t *testing.T) {
+	c := newReplicas(t, 1)[0]
+	if _, err := c.RegisterReceiver(100); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	errs := parallel(len(groups), func(i int) error {
+		_, err := c.AddRoute(100, map[string]string{"alertgroup": groups[i]})
+
+		return err
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("failed to add route %s: %s", groups[i], err)
+		}
+	}
+
+	routes, err := c.Routes(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != len(groups) {
+		t.Errorf("expected %d routes, got %d", len(groups), len(routes))
+	}
+}
+
+func TestUpdateParallelAddRemove(t *testing.T) {
+	replicas := newReplicas(t, 3)
+	c := replicas[0]
+	for _, receiver := range []int64{100, 200, 300} {
+		if _, err := c.RegisterReceiver(receiver); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, group := range []string{"a", "b", "c"} {
+		if _, err := c.AddRoute(100, map[string]string{"alertgroup": group}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.AddRoute(200, map[string]string{"alertgroup": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddRoute(300, map[string]string{"alertgroup": "y"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// every replica runs several changes concurrently
+	ops := []func(c *Config) (*Change, error){
+		func(c *Config) (*Change, error) { return c.AddRoute(100, map[string]string{"alertgroup": "d"}) },
+		func(c *Config) (*Change, error) { return c.AddRoute(100, map[string]string{"alertgroup": "e"}) },
+		func(c *Config) (*Change, error) { return c.RemoveRoute(100, map[string]string{"alertgroup": "a"}) },
+		func(c *Config) (*Change, error) { return c.RemoveRouteByName(100, "b") },
+		func(c *Config) (*Change, error) { return c.DisableReceiver(200) },
+		func(c *Config) (*Change, error) { return c.AddRoute(300, map[string]string{"alertgroup": "z"}) },
+		func(c *Config) (*Change, error) { return c.RemoveRouteByName(300, "y") },
+		func(c *Config) (*Change, error) { return c.AddRoute(100, map[string]string{"alertgroup": "f"}) },
+		func(c *Config) (*Change, error) { return c.RegisterReceiver(400) },
+	}
+	errs := parallel(len(ops), func(i int) error {
+		_, err := ops[i](replicas[i%len(replicas)])
+
+		return err
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("change %d failed: %s", i, err)
+		}
+	}
+
+	tests := []struct {
+		receiver int64
+		routes   []string
+	}{
+		{100, []string{"c", "d", "e", "f"}},
+		{200, nil},
+		{300, []string{"z"}},
+		{400, nil},
+	}
+	for _, tt := range tests {
+		routes, err := replicas[1].Routes(tt.receiver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range routes {
+			names = append(names, RouteName(r))
+		}
+		sort.Strings(names)
+		if fmt.Sprint(names) != fmt.Sprint(tt.routes) {
+			t.Errorf("expected routes %v of receiver %d, got %v", tt.routes, tt.receiver, names)
+		}
+	}
+
+	for receiver, want := range map[int64]bool{100: true, 200: false, 300: true, 400: true} {
+		if exists, err := replicas[2].IsReceiverExists(receiver); err != nil || exists != want {
+			t.Errorf("expected receiver %d existence %t, got %t, %v", receiver, want, exists, err)
+		}
+	}
+}
+
+func TestAddRouteParallelWithCatchAll(t *testing.T) {
+	for n := 0; n < 5; n++ {
+		replicas := newReplicas(t, 2)
+		if _, err := replicas[0].RegisterReceiver(100); err != nil {
+			t.Fatal(err)
+		}
+
+		m, _ := labels.NewMatcher(labels.MatchEqual, "severity", "critical")
+		errs := parallel(2, func(i int) error {
+			if i == 0 {
+				_, err := replicas[0].AddRoute(100, nil)
+
+				return err
+			}
+
+			_, err := replicas[1].AddMatchersRoute(100, amcfg.Matchers{m})
+
+			return err
+		})
+		if errs[0] != nil {
+			t.Fatalf("failed to add catch-all route: %s", errs[0])
+		}
+		if errs[1] != nil && errs[1] != ErrSubscribedToAll {
+			t.Fatalf("unexpected error on adding matchers route: %s", errs[1])
+		}
+
+		routes, err := replicas[0].Routes(100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(routes) != 1 || routes[0].Match != nil || len(routes[0].Matchers) != 0 {
+			t.Errorf("expected single catch-all route, got %v", routes)
+		}
+	}
+}
+
+func TestAddRouteSubscribedToAll(t *testing.T) {
+	c := newReplicas(t, 1)[0]
+	if _, err := c.RegisterReceiver(100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddRoute(100, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.AddRoute(100, map[string]string{"alertgroup": "a"}); err != ErrSubscribedToAll {
+		t.Errorf("expected ErrSubscribedToAll, got %v", err)
+	}
+	m, _ := labels.NewMatcher(labels.MatchEqual, "severity", "critical")
+	if _, err := c.AddMatchersRoute(100, amcfg.Matchers{m}); err != ErrSubscribedToAll {
+		t.Errorf("expected ErrSubscribedToAll, got %v", err)
+	}
+	// repeated catch-all subscription isn't an error
+	if _, err := c.AddRoute(100, nil); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+}
+
+func TestSecretStorageConflict(t *testing.T) {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "alertmanager"},
+		Data:       map[string][]byte{ConfigKey: []byte(testDestConfig)},
+	}
+	kc := fake.NewClientBuilder().WithObjects(secret).Build()
+	s := NewSecretStorage("monitoring", "alertmanager", kc)
+
+	_, revision, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write([]byte(testDestConfig), revision); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := s.Write([]byte(testDestConfig), revision); err != ErrConflict {
+		t.Errorf("expected ErrConflict on outdated revision, got %v", err)
+	}
+
+	var current v1.Secret
+	if err := kc.Get(context.Background(), client.ObjectKeyFromObject(secret), &current); err != nil {
+		t.Fatal(err)
+	}
+	if current.ResourceVersion == revision {
+		t.Errorf("revision isn't changed after write")
+	}
+}
+
+func TestConfigMapStorageConflict(t *testing.T) {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "alertmanager"},
+		Data:       map[string]string{ConfigKey: testDestConfig},
+	}
+	kc := fake.NewClientBuilder().WithObjects(cm).Build()
+	s := NewConfigMapStorage("monitoring", "alertmanager", kc)
+
+	_, revision, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Write([]byte(testDestConfig), revision); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := s.Write([]byte(testDestConfig), revision); err != ErrConflict {
+		t.Errorf("expected ErrConflict on outdated revision, got %v", err)
+	}
+
+	_, current, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current == revision {
+		t.Errorf("revision isn't changed after write")
+	}
+}
+
+func TestFileStorageConflict(t *testing.T) {
+	s := NewFileStorage(writeTestFile(t, testDestConfig))
+
+	data, revision, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// revision is content hash, so it is changed only by another content
+	changed := append(data, []byte("templates: []\n")...)
+	if err := s.Write(data, revision); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := s.Write(changed, revision); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := s.Write(data, revision); err != ErrConflict {
+		t.Errorf("expected ErrConflict on outdated revision, got %v", err)
+	}
+
+	current, next, err := s.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current) != string(changed) || next == revision {
+		t.Errorf("expected changed config with new revision, got %q with %s", current, next)
+	}
+}
+
+func TestUpdateChange(t *testing.T) {
+	c := newReplicas(t, 1)[0]
+
+	change, err := c.RegisterReceiver(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change == nil || change.Before == "" || change.After == "" || change.Before == change.After {
+		t.Fatalf("unexpected change %+v", change)
+	}
+
+	// config isn't written and change isn't returned, if nothing is changed
+	if change, err := c.RegisterReceiver(100); err != nil || change != nil {
+		t.Errorf("expected no change, got %+v, %v", change, err)
+	}
+	if change, err := c.RemoveRoute(100, nil); err != nil || change != nil {
+		t.Errorf("expected no change, got %+v, %v", change, err)
+	}
+
+	next, err := c.AddRoute(100, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Before != change.After {
+		t.Errorf("expected change based on %s, got %s", change.After, next.Before)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	replicas := newReplicas(t, 2)
+
+	first, err := replicas[0].RegisterReceiver(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := replicas[1].RegisterReceiver(200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// first change is replaced by another replica, so it can't be restored
+	if _, err := replicas[0].Rollback(first); err == nil {
+		t.Fatalf("outdated change is rolled back")
+	}
+	if ok, _ := replicas[0].IsReceiverExists(200); !ok {
+		t.Fatalf("change of another replica is lost")
+	}
+
+	rollback, err := replicas[0].Rollback(second)
+	if err != nil {
+		t.Fatalf("failed to rollback: %s", err)
+	}
+	if rollback.Before != second.After || rollback.After != second.Before {
+		t.Errorf("unexpected rollback change %+v of %+v", rollback, second)
+	}
+	if ok, _ := replicas[0].IsReceiverExists(200); ok {
+		t.Errorf("receiver isn't removed by rollback")
+	}
+	if ok, _ := replicas[0].IsReceiverExists(100); !ok {
+		t.Errorf("receiver of previous change is removed by rollback")
+	}
+}
+
+func TestRegisterReceiverKeepsSettings(t *testing.T) {
+	c, path := newTestConfig(t, testDestConfig, "")
+	if _, err := c.RegisterReceiver(100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetSendResolved(100, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// chat is registered again by bot with changed webhook url
+	wu, _ := url.Parse("http://bot:9000/webhook")
+	c = New(NewFileStorage(path), nil, wu)
+	if _, err := c.RegisterReceiver(100); err != nil {
+		t.Fatal(err)
+	}
+
+	sendResolved, err := c.SendResolved(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sendResolved {
+		t.Errorf("send_resolved is reset by registration")
+	}
+
+	conf, err := c.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := conf.Receivers[getReceiverPosition(conf.Receivers, botReceiverName(100))]
+	if len(rc.WebhookConfigs) != 1 || rc.WebhookConfigs[0].URL.String() != wu.String() {
+		t.Errorf("expected webhook url %s, got %+v", wu, rc.WebhookConfigs)
+	}
+}
+
+func TestMigrateReceiver(t *testing.T) {
+	intervals := []timeinterval.TimeInterval{{
+		Times: []timeinterval.TimeRange{{StartMinute: 22 * 60, EndMinute: 24 * 60}},
+	}}
+
+	tests := []struct {
+		name string
+		// target chat is registered already with single route and without quiet hours
+		registered bool
+		routes     []string
+		quiet      string
+	}{
+		{"new chat", false, []string{"a", "b"}, "tg-200-quiet-except-critical"},
+		{"registered chat", true, []string{"b", "a"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newReplicas(t, 1)[0]
+			if _, err := c.RegisterReceiver(100); err != nil {
+				t.Fatal(err)
+			}
+			if tt.registered {
+				if _, err := c.RegisterReceiver(200); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := c.AddRoute(200, map[string]string{"alertgroup": "b"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, group := range []string{"a", "b"} {
+				if _, err := c.AddRoute(100, map[string]string{"alertgroup": group}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := c.SetQuietHours(100, intervals, true); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := c.MigrateReceiver(100, 200); err != nil {
+				t.Fatalf("failed to migrate receiver: %s", err)
+			}
+
+			if exists, err := c.IsReceiverExists(100); err != nil || exists {
+				t.Errorf("receiver of migrated chat isn't removed: %t, %v", exists, err)
+			}
+			routes, err := c.Routes(200)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, r := range routes {
+				names = append(names, RouteName(r))
+
+				var quiet string
+				if len(r.MuteTimeIntervals) > 0 {
+					quiet = r.MuteTimeIntervals[0]
+				}
+				if quiet != tt.quiet {
+					t.Errorf("expected route %s muted by %q, got %q", RouteName(r), tt.quiet, quiet)
+				}
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.routes) {
+				t.Errorf("expected routes %v, got %v", tt.routes, names)
+			}
+
+			conf, err := c.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, mt := range conf.MuteTimeIntervals {
+				if quietHoursReceiver(mt.Name) == botReceiverName(100) {
+					t.Errorf("quiet hours of migrated chat are kept: %s", mt.Name)
+				}
+			}
+		})
+	}
+
+	c := newReplicas(t, 1)[0]
+	if _, err := c.MigrateReceiver(300, 400); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for unknown receiver, got %v", err)
+	}
+}
+
+func TestRestrictRoutes(t *testing.T) {
+	c := newReplicas(t, 1)[0]
+	for _, receiver := range []int64{100, 200} {
+		if _, err := c.RegisterReceiver(receiver); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := c.AddRoute(100, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range []string{"payments", "ops", "billing"} {
+		if _, err := c.AddRoute(200, map[string]string{"alertgroup": group}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	receivers, err := c.Receivers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(receivers) != "[100 200]" {
+		t.Fatalf("expected receivers [100 200], got %v", receivers)
+	}
+
+	// alerts of payments team are allowed, alerts of billing group can't match them
+	team, _ := labels.NewMatcher(labels.MatchEqual, "team", "payments")
+	restrict := func(ms labels.Matchers) ([]labels.Matchers, bool) {
+		for _, m := range ms {
+			switch m.String() {
+			case `alertgroup="payments"`, team.String():
+				return nil, true
+			case `alertgroup="billing"`:
+				return nil, false
+			}
+		}
+
+		return []labels.Matchers{append(append(labels.Matchers{}, ms...), team)}, false
+	}
+
+	tests := []struct {
+		receiver int64
+		routes   []string
+	}{
+		{100, []string{`{team="payments"}`}},
+		{200, []string{"payments", `{alertgroup="ops",team="payments"}`}},
+	}
+
+	for _, tt := range tests {
+		change, err := c.RestrictRoutes(tt.receiver, restrict)
+		if err != nil || change == nil {
+			t.Fatalf("failed to restrict routes of receiver %d: %v", tt.receiver, err)
+		}
+
+		routes, err := c.Routes(tt.receiver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, route := range routes {
+			names = append(names, RouteName(route))
+		}
+		if fmt.Sprint(names) != fmt.Sprint(tt.routes) {
+			t.Errorf("expected routes %v of receiver %d, got %v", tt.routes, tt.receiver, names)
+		}
+
+		// restricted routes are allowed
+		if change, err := c.RestrictRoutes(tt.receiver, restrict); err != nil || change != nil {
+			t.Errorf("expected no change, got %+v, %v", change, err)
+		}
+	}
+}
+
+func TestQuietHoursSupported(t *testing.T) {
+	kc := fake.NewClientBuilder().Build()
+	tests := []struct {
+		name string
+		dest Storage
+		want bool
+	}{
+		{"secret", NewSecretStorage("monitoring", "alertmanager", kc), true},
+		{"file", NewFileStorage("alertmanager.yml"), true},
+		{"alertmanagerconfig", NewAlertmanagerConfigStorage("monitoring", "bot", kc), false},
+		{"vmalertmanagerconfig", NewVMAlertmanagerConfigStorage("monitoring", "bot", kc), true},
+	}
+
+	for _, tt := range tests {
+		if got := New(tt.dest, nil, nil).QuietHoursSupported(); got != tt.want {
+			t.Errorf("%s: expected %t, got %t", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	amcfg "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	commoncfg "github.com/prometheus/common/config"
+	"github.com/prometheus/common/model"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// receiver of synthetic config root route and of custom resources
+	// top level routes, alerts not matched by subscriptions are dropped there
+	nullReceiver = "null"
+	// receiver name inside custom resources
+	crdReceiver = "telegram"
+
+	managedByLabel     = "app.kubernetes.io/managed-by"
+	managedByValue     = "alertmanager-bot"
+	receiverAnnotation = "alertmanager-bot/receiver"
+)
+
+// receiverConfig is operator independent content of receiver custom resource
+type receiverConfig struct {
+	receiver     string
+	url          string
+	sendResolved bool
+	routes       []*amcfg.Route
+	// receiver quiet hours
+	muteTimeIntervals []amcfg.MuteTimeInterval
+}
+
+// operatorAPI converts receiver configs into custom resources of specific operator
+type operatorAPI interface {
+	newObject() client.Object
+	list(ctx context.Context, kc client.Client, namespace string) ([]client.Object, error)
+	decode(obj client.Object) (*receiverConfig, error)
+	encode(obj client.Object, rc *receiverConfig) error
+	// separator returns separator of namespace, object and receiver
+	// names in receiver name generated by operator
+	separator() string
+	// muteTimeIntervals returns true, if resources may contain mute time intervals
+	muteTimeIntervals() bool
+}
+
+// crdStorage keeps every bot receiver with its routes in separate custom resource,
+// which are merged into alertmanager config by operator. Resources are presented
+// as config with receivers and routes only, so they are managed as usual config.
+type crdStorage struct {
+	namespace, prefix string
+	kc                client.Client
+	api               operatorAPI
+}
+
+func (s *crdStorage) objectName(receiver string) string {
+	return fmt.Sprintf("%s-%s", s.prefix, receiver)
+}
+
+// ReceiverName returns receiver name generated by operator for bot receiver
+func (s *crdStorage) ReceiverName(receiver string) string {
+	sep := s.api.separator()
+
+	return s.namespace + sep + s.objectName(receiver) + sep + crdReceiver
+}
+
+// ParseReceiverName returns bot receiver from receiver name generated by operator
+func (s *crdStorage) ParseReceiverName(name string) (string, bool) {
+	sep := s.api.separator()
+	prefix := s.namespace + sep + s.prefix + "-"
+	suffix := sep + crdReceiver
+
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) || len(name) <= len(prefix)+len(suffix) {
+		return "", false
+	}
+
+	return name[len(prefix) : len(name)-len(suffix)], true
+}
+
+// SelfReloading returns true, because operator reloads alertmanager itself
+func (s *crdStorage) SelfReloading() bool {
+	return true
+}
+
+// QuietHoursSupported returns true, if operator resources have mute time intervals
+func (s *crdStorage) QuietHoursSupported() bool {
+	return s.api.muteTimeIntervals()
+}
+
+func (s *crdStorage) Read() ([]byte, string, error) {
+	objs, err := s.api.list(context.Background(), s.kc, s.namespace)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list receivers custom resources: %s", err)
+	}
+
+	conf := &amcfg.Config{
+		Route:     &amcfg.Route{Receiver: nullReceiver},
+		Receivers: []*amcfg.Receiver{{Name: nullReceiver}},
+	}
+	for _, obj := range objs {
+		rc, err := s.api.decode(obj)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decode %s: %s", obj.GetName(), err)
+		}
+
+		u, err := url.Parse(rc.url)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse %s webhook url: %s", obj.GetName(), err)
+		}
+
+		name := ReceiverPrefix + rc.receiver
+		// http config is set as alertmanager does on load, so unchanged receivers are rendered as is
+		hc := commoncfg.DefaultHTTPClientConfig
+		conf.Receivers = append(conf.Receivers, &amcfg.Receiver{
+			Name: name,
+			WebhookConfigs: []*amcfg.WebhookConfig{{
+				NotifierConfig: amcfg.NotifierConfig{VSendResolved: rc.sendResolved},
+				HTTPConfig:     &hc,
+				URL:            &amcfg.URL{URL: u},
+			}},
+		})
+		for _, route := range rc.routes {
+			setReceiver(route, name)
+		}
+
+		br := botRoute(conf)
+		br.Routes = append(br.Routes, rc.routes...)
+		conf.MuteTimeIntervals = append(conf.MuteTimeIntervals, rc.muteTimeIntervals...)
+	}
+
+	return []byte(conf.String()), objectsRevision(objs), nil
+}
+
+func (s *crdStorage) Write(data []byte, revision string) error {
+	ctx := context.Background()
+
+	objs, err := s.api.list(ctx, s.kc, s.namespace)
+	if err != nil {
+		return fmt.Errorf("failed to list receivers custom resources: %s", err)
+	}
+	if objectsRevision(objs) != revision {
+		return ErrConflict
+	}
+
+	conf, err := amcfg.Load(string(data))
+	if err != nil {
+		return fmt.Errorf("failed unmarshal alertmanager.yaml file: %s", err)
+	}
+
+	existing := make(map[string]client.Object)
+	for _, obj := range objs {
+		existing[obj.GetName()] = obj
+	}
+
+	br := botRoute(conf)
+	for _, r := range conf.Receivers {
+		if !isBotReceiver(r.Name) || r.Name == BotRouteReceiver {
+			continue
+		}
+
+		rc := &receiverConfig{receiver: strings.TrimPrefix(r.Name, ReceiverPrefix)}
+		if len(r.WebhookConfigs) > 0 && r.WebhookConfigs[0].URL != nil {
+			rc.url = r.WebhookConfigs[0].URL.String()
+			rc.sendResolved = r.WebhookConfigs[0].SendResolved()
+		}
+		for _, route := range br.Routes {
+			if route.Receiver == r.Name {
+				rc.routes = append(rc.routes, route)
+			}
+		}
+		for _, mt := range conf.MuteTimeIntervals {
+			if quietHoursReceiver(mt.Name) == r.Name {
+				rc.muteTimeIntervals = append(rc.muteTimeIntervals, mt)
+			}
+		}
+
+		name := s.objectName(rc.receiver)
+		obj, ok := existing[name]
+		delete(existing, name)
+
+		if !ok {
+			obj = s.api.newObject()
+			obj.SetName(name)
+			obj.SetNamespace(s.namespace)
+			obj.SetLabels(map[string]string{managedByLabel: managedByValue})
+			obj.SetAnnotations(map[string]string{receiverAnnotation: rc.receiver})
+			if err := s.api.encode(obj, rc); err != nil {
+				return fmt.Errorf("failed to encode %s: %s", name, err)
+			}
+
+			if err := s.kc.Create(ctx, obj); apierrors.IsAlreadyExists(err) {
+				return ErrConflict
+			} else if err != nil {
+				return fmt.Errorf("failed to create %s: %s", name, err)
+			}
+
+			continue
+		}
+
+		before, err := json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %s", name, err)
+		}
+		if err := s.api.encode(obj, rc); err != nil {
+			return fmt.Errorf("failed to encode %s: %s", name, err)
+		}
+		after, err := json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s: %s", name, err)
+		}
+		if string(before) == string(after) {
+			continue
+		}
+
+		if err := s.kc.Update(ctx, obj); apierrors.IsConflict(err) {
+			return ErrConflict
+		} else if err != nil {
+			return fmt.Errorf("failed to update %s: %s", name, err)
+		}
+	}
+
+	// receivers removed from config
+	for name, obj := range existing {
+		if err := s.kc.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete %s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// setReceiver sets receiver of route and its child routes
+func setReceiver(route *amcfg.Route, receiver string) {
+	route.Receiver = receiver
+	for _, child := range route.Routes {
+		setReceiver(child, receiver)
+	}
+}
+
+// objectsRevision returns revision of all given objects
+func objectsRevision(objs []client.Object) string {
+	versions := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		versions = append(versions, obj.GetName()+":"+obj.GetResourceVersion())
+	}
+	sort.Strings(versions)
+
+	sum := sha256.Sum256([]byte(strings.Join(versions, ",")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// objectReceiver returns bot receiver of custom resource
+func objectReceiver(obj client.Object) (string, error) {
+	receiver, ok := obj.GetAnnotations()[receiverAnnotation]
+	if !ok {
+		return "", fmt.Errorf("%s annotation is not found", receiverAnnotation)
+	}
+
+	if _, err := strconv.ParseInt(receiver, 10, 64); err != nil {
+		return "", fmt.Errorf("receiver %s is incorrect: %s", receiver, err)
+	}
+
+	return receiver, nil
+}
+
+// newRoute returns bot route with given matchers and notification settings
+func newRoute(receiver string, ms labels.Matchers, groupBy []string, groupWait, groupInterval, repeatInterval string) (*amcfg.Route, error) {
+	r := &amcfg.Route{Receiver: receiver, Continue: true, GroupByStr: groupBy}
+
+	// plain alert group subscription is stored as match, like it is done by bot
+	if len(ms) == 1 && ms[0].Name == "alertgroup" && ms[0].Type == labels.MatchEqual {
+		r.Match = map[string]string{"alertgroup": ms[0].Value}
+	} else if len(ms) > 0 {
+		r.Matchers = amcfg.Matchers(ms)
+	}
+
+	durations := []struct {
+		value string
+		dest  **model.Duration
+	}{
+		{groupWait, &r.GroupWait},
+		{groupInterval, &r.GroupInterval},
+		{repeatInterval, &r.RepeatInterval},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+
+		v, err := model.ParseDuration(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse duration: %s", err)
+		}
+		*d.dest = &v
+	}
+
+	return r, nil
+}
+
+// durationString returns string representation of optional duration
+func durationString(d *model.Duration) string {
+	if d == nil {
+		return ""
+	}
+
+	return d.String()
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	monv1alpha1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1alpha1"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	if err := monv1alpha1.AddToScheme(scheme.Scheme); err != nil {
+		panic(err)
+	}
+}
+
+// NewAlertmanagerConfigStorage returns storage keeping receivers
+// in prometheus operator AlertmanagerConfig resources
+func NewAlertmanagerConfigStorage(namespace, prefix string, kc client.Client) Storage {
+	return &crdStorage{namespace: namespace, prefix: prefix, kc: kc, api: alertmanagerConfigAPI{}}
+}
+
+type alertmanagerConfigAPI struct{}
+
+func (alertmanagerConfigAPI) newObject() client.Object {
+	return &monv1alpha1.AlertmanagerConfig{}
+}
+
+func (alertmanagerConfigAPI) list(ctx context.Context, kc client.Client, namespace string) ([]client.Object, error) {
+	list := &monv1alpha1.AlertmanagerConfigList{}
+	if err := kc.List(ctx, list, client.InNamespace(namespace), client.MatchingLabels{managedByLabel: managedByValue}); err != nil {
+		return nil, err
+	}
+
+	out := make([]client.Object, 0, len(list.Items))
+	for _, item := range list.Items {
+		out = append(out, item)
+	}
+
+	return out, nil
+}
+
+func (alertmanagerConfigAPI) decode(obj client.Object) (*receiverConfig, error) {
+	c := obj.(*monv1alpha1.AlertmanagerConfig)
+
+	receiver, err := objectReceiver(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	// alertmanager notifies about resolved alerts by default
+	rc := &receiverConfig{receiver: receiver, sendResolved: true}
+	for _, r := range c.Spec.Receivers {
+		if r.Name == crdReceiver && len(r.WebhookConfigs) > 0 && r.WebhookConfigs[0].URL != nil {
+			rc.url = *r.WebhookConfigs[0].URL
+			if r.WebhookConfigs[0].SendResolved != nil {
+				rc.sendResolved = *r.WebhookConfigs[0].SendResolved
+			}
+		}
+	}
+
+	if c.Spec.Route == nil {
+		return rc, nil
+	}
+
+	children, err := c.Spec.Route.ChildRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, child := range children {
+		ms := make(labels.Matchers, 0, len(child.Matchers))
+		for _, m := range child.Matchers {
+			t := labels.MatchEqual
+			if m.Regex {
+				t = labels.MatchRegexp
+			}
+
+			matcher, err := labels.NewMatcher(t, m.Name, m.Value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse matcher: %s", err)
+			}
+			ms = append(ms, matcher)
+		}
+
+		route, err := newRoute(receiver, ms, child.GroupBy, child.GroupWait, child.GroupInterval, child.RepeatInterval)
+		if err != nil {
+			return nil, err
+		}
+		rc.routes = append(rc.routes, route)
+	}
+
+	return rc, nil
+}
+
+func (alertmanagerConfigAPI) encode(obj client.Object, rc *receiverConfig) error {
+	c := obj.(*monv1alpha1.AlertmanagerConfig)
+
+	if len(rc.muteTimeIntervals) > 0 {
+		return fmt.Errorf("mute time intervals are not supported by AlertmanagerConfig")
+	}
+
+	routes := make([]apiextensionsv1.JSON, 0, len(rc.routes))
+	for _, r := range rc.routes {
+		if len(r.MuteTimeIntervals) > 0 {
+			return fmt.Errorf("mute time intervals are not supported by AlertmanagerConfig")
+		}
+		if len(r.Routes) > 0 {
+			return fmt.Errorf("nested routes are not supported by AlertmanagerConfig storage")
+		}
+
+		child := monv1alpha1.Route{
+			Receiver:       crdReceiver,
+			GroupBy:        r.GroupByStr,
+			GroupWait:      durationString(r.GroupWait),
+			GroupInterval:  durationString(r.GroupInterval),
+			RepeatInterval: durationString(r.RepeatInterval),
+			Continue:       r.Continue,
+		}
+		for _, m := range routeMatchers(r) {
+			switch m.Type {
+			case labels.MatchEqual:
+				child.Matchers = append(child.Matchers, monv1alpha1.Matcher{Name: m.Name, Value: m.Value})
+			case labels.MatchRegexp:
+				child.Matchers = append(child.Matchers, monv1alpha1.Matcher{Name: m.Name, Value: m.Value, Regex: true})
+			default:
+				return fmt.Errorf("matcher %s is not supported by AlertmanagerConfig", m)
+			}
+		}
+
+		raw, err := json.Marshal(child)
+		if err != nil {
+			return fmt.Errorf("failed to marshal route: %s", err)
+		}
+		routes = append(routes, apiextensionsv1.JSON{Raw: raw})
+	}
+
+	url, sendResolved := rc.url, rc.sendResolved
+	c.Spec.Route = &monv1alpha1.Route{Receiver: nullReceiver, Routes: routes}
+	c.Spec.Receivers = []monv1alpha1.Receiver{
+		{Name: nullReceiver},
+		{Name: crdReceiver, WebhookConfigs: []monv1alpha1.WebhookConfig{{URL: &url, SendResolved: &sendResolved}}},
+	}
+
+	return nil
+}
+
+func (alertmanagerConfigAPI) separator() string {
+	return "/"
+}
+
+func (alertmanagerConfigAPI) muteTimeIntervals() bool {
+	return false
+}
@@ -0,0 +1,231 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"testing"
+
+	amcfg "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/timeinterval"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var crdStorages = []struct {
+	name string
+	new  func(kc client.Client) Storage
+}{
+	{"alertmanagerconfig", func(kc client.Client) Storage { return NewAlertmanagerConfigStorage("monitoring", "bot", kc) }},
+	{"vmalertmanagerconfig", func(kc client.Client) Storage { return NewVMAlertmanagerConfigStorage("monitoring", "bot", kc) }},
+}
+
+func newCRDConfig(dest Storage) *Config {
+	wu, _ := url.Parse("http://bot:8000/webhook")
+
+	return New(dest, nil, wu)
+}
+
+// objectNames returns names of receivers custom resources
+func objectNames(t *testing.T, dest Storage) []string {
+	t.Helper()
+
+	s := dest.(*crdStorage)
+	objs, err := s.api.list(context.Background(), s.kc, s.namespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out []string
+	for _, obj := range objs {
+		out = append(out, obj.GetName())
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// routeNames returns names of receiver routes
+func routeNames(t *testing.T, c *Config, receiver int64) []string {
+	t.Helper()
+
+	routes, err := c.Routes(receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out []string
+	for _, r := range routes {
+		out = append(out, RouteName(r))
+	}
+
+	return out
+}
+
+func TestCRDStorageRoundTrip(t *testing.T) {
+	team, _ := labels.NewMatcher(labels.MatchEqual, "team", "ops")
+	severity, _ := labels.NewMatcher(labels.MatchRegexp, "severity", "warning|critical")
+	wait := model.Duration(90 * 1e9)
+
+	for _, tt := range crdStorages {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := fake.NewClientBuilder().Build()
+			c := newCRDConfig(tt.new(kc))
+
+			if _, err := c.RegisterReceiver(100); err != nil {
+				t.Fatalf("failed to register receiver: %s", err)
+			}
+			if _, err := c.AddRoute(100, map[string]string{"alertgroup": "node"}); err != nil {
+				t.Fatalf("failed to add route: %s", err)
+			}
+			if _, err := c.AddMatchersRoute(100, amcfg.Matchers{team, severity}); err != nil {
+				t.Fatalf("failed to add matchers route: %s", err)
+			}
+			if _, err := c.UpdateRouteSettings(100, "node", func(s *RouteSettings) {
+				s.GroupBy = []string{"alertname", "instance"}
+				s.GroupWait = &wait
+			}); err != nil {
+				t.Fatalf("failed to update route settings: %s", err)
+			}
+			if _, err := c.SetSendResolved(100, false); err != nil {
+				t.Fatalf("failed to change send_resolved: %s", err)
+			}
+
+			// config is read from resources by another replica
+			c = newCRDConfig(tt.new(kc))
+			want := []string{"node", `{severity=~"warning|critical",team="ops"}`}
+			if got := routeNames(t, c, 100); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("expected routes %v, got %v", want, got)
+			}
+
+			routes, err := c.Routes(100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := GetRouteSettings(routes[0])
+			if fmt.Sprint(s.GroupBy) != "[alertname instance]" || s.GroupWait == nil || *s.GroupWait != wait {
+				t.Errorf("unexpected route settings %+v", s)
+			}
+			if s := GetRouteSettings(routes[1]); s.GroupWait != nil || len(s.GroupBy) != 0 {
+				t.Errorf("settings of another route are changed: %+v", s)
+			}
+			if !routes[0].Continue || !routes[1].Continue {
+				t.Errorf("routes must continue")
+			}
+
+			if sendResolved, err := c.SendResolved(100); err != nil || sendResolved {
+				t.Errorf("expected disabled send_resolved, got %t, %v", sendResolved, err)
+			}
+
+			// repeated registration changes nothing
+			if change, err := c.RegisterReceiver(100); err != nil || change != nil {
+				t.Errorf("expected no change, got %+v, %v", change, err)
+			}
+
+			if _, err := c.MigrateReceiver(100, 200); err != nil {
+				t.Fatalf("failed to migrate receiver: %s", err)
+			}
+			if got := routeNames(t, c, 200); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("expected migrated routes %v, got %v", want, got)
+			}
+			if got := objectNames(t, c.dest); fmt.Sprint(got) != "[bot-200]" {
+				t.Errorf("expected resources of migrated receiver, got %v", got)
+			}
+
+			if _, err := c.DisableReceiver(200); err != nil {
+				t.Fatalf("failed to disable receiver: %s", err)
+			}
+			if got := objectNames(t, c.dest); len(got) != 0 {
+				t.Errorf("resources of disabled receiver aren't deleted: %v", got)
+			}
+		})
+	}
+}
+
+func TestCRDStorageQuietHours(t *testing.T) {
+	var intervals []timeinterval.TimeInterval
+	data := `
+- times: [{start_time: "22:00", end_time: "24:00"}]
+  weekdays: ["monday:friday"]
+`
+	if err := yaml.Unmarshal([]byte(data), &intervals); err != nil {
+		t.Fatal(err)
+	}
+
+	kc := fake.NewClientBuilder().Build()
+	c := newCRDConfig(NewVMAlertmanagerConfigStorage("monitoring", "bot", kc))
+	if _, err := c.RegisterReceiver(100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AddRoute(100, map[string]string{"alertgroup": "node"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SetQuietHours(100, intervals, true); err != nil {
+		t.Fatalf("failed to set quiet hours: %s", err)
+	}
+
+	c = newCRDConfig(NewVMAlertmanagerConfigStorage("monitoring", "bot", kc))
+	got, exceptCritical, err := c.QuietHours(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exceptCritical {
+		t.Errorf("critical alerts aren't exempt from quiet hours")
+	}
+	if out, _ := yaml.Marshal(got); string(out) != mustMarshal(t, intervals) {
+		t.Errorf("expected intervals %s, got %s", mustMarshal(t, intervals), out)
+	}
+
+	routes, err := c.Routes(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 1 || fmt.Sprint(routes[0].MuteTimeIntervals) != "[tg-100-quiet-except-critical]" {
+		t.Fatalf("route isn't muted by quiet hours: %+v", routes)
+	}
+	if len(routes[0].Routes) != 1 || RouteName(routes[0].Routes[0]) != `{severity="critical"}` {
+		t.Errorf("expected critical alerts child route, got %+v", routes[0].Routes)
+	}
+}
+
+func TestCRDStorageConflict(t *testing.T) {
+	for _, tt := range crdStorages {
+		t.Run(tt.name, func(t *testing.T) {
+			kc := fake.NewClientBuilder().Build()
+			dest := tt.new(kc)
+			c := newCRDConfig(dest)
+			if _, err := c.RegisterReceiver(100); err != nil {
+				t.Fatal(err)
+			}
+
+			data, revision, err := dest.Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// resource is changed by another replica
+			if _, err := newCRDConfig(tt.new(kc)).SetSendResolved(100, false); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := dest.Write(data, revision); err != ErrConflict {
+				t.Errorf("expected ErrConflict for stale revision, got %v", err)
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	out, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(out)
+}
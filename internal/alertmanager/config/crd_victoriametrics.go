@@ -0,0 +1,181 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	vm "github.com/VictoriaMetrics/operator/api/v1beta1"
+	amcfg "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func init() {
+	if err := vm.AddToScheme(scheme.Scheme); err != nil {
+		panic(err)
+	}
+}
+
+// NewVMAlertmanagerConfigStorage returns storage keeping receivers
+// in victoriametrics operator VMAlertmanagerConfig resources
+func NewVMAlertmanagerConfigStorage(namespace, prefix string, kc client.Client) Storage {
+	return &crdStorage{namespace: namespace, prefix: prefix, kc: kc, api: vmAlertmanagerConfigAPI{}}
+}
+
+type vmAlertmanagerConfigAPI struct{}
+
+func (vmAlertmanagerConfigAPI) newObject() client.Object {
+	return &vm.VMAlertmanagerConfig{}
+}
+
+func (vmAlertmanagerConfigAPI) list(ctx context.Context, kc client.Client, namespace string) ([]client.Object, error) {
+	list := &vm.VMAlertmanagerConfigList{}
+	if err := kc.List(ctx, list, client.InNamespace(namespace), client.MatchingLabels{managedByLabel: managedByValue}); err != nil {
+		return nil, err
+	}
+
+	out := make([]client.Object, 0, len(list.Items))
+	for i := range list.Items {
+		out = append(out, &list.Items[i])
+	}
+
+	return out, nil
+}
+
+func (vmAlertmanagerConfigAPI) decode(obj client.Object) (*receiverConfig, error) {
+	c := obj.(*vm.VMAlertmanagerConfig)
+
+	receiver, err := objectReceiver(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	// alertmanager notifies about resolved alerts by default
+	rc := &receiverConfig{receiver: receiver, sendResolved: true}
+	for _, r := range c.Spec.Receivers {
+		if r.Name == crdReceiver && len(r.WebhookConfigs) > 0 && r.WebhookConfigs[0].URL != nil {
+			rc.url = *r.WebhookConfigs[0].URL
+			if r.WebhookConfigs[0].SendResolved != nil {
+				rc.sendResolved = *r.WebhookConfigs[0].SendResolved
+			}
+		}
+	}
+
+	if c.Spec.Route == nil {
+		return rc, nil
+	}
+
+	for _, child := range c.Spec.Route.Routes {
+		route, err := vmDecodeRoute(receiver, child)
+		if err != nil {
+			return nil, err
+		}
+		rc.routes = append(rc.routes, route)
+	}
+
+	for _, mti := range c.Spec.MutTimeIntervals {
+		mt := amcfg.MuteTimeInterval{Name: mti.Name}
+		if err := convertTimeIntervals(mti.TimeIntervals, &mt.TimeIntervals); err != nil {
+			return nil, fmt.Errorf("failed to convert time interval %s: %s", mti.Name, err)
+		}
+		rc.muteTimeIntervals = append(rc.muteTimeIntervals, mt)
+	}
+
+	return rc, nil
+}
+
+func vmDecodeRoute(receiver string, in *vm.Route) (*amcfg.Route, error) {
+	ms := make(labels.Matchers, 0, len(in.Matchers))
+	for _, value := range in.Matchers {
+		m, err := labels.ParseMatcher(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse matcher: %s", err)
+		}
+		ms = append(ms, m)
+	}
+
+	route, err := newRoute(receiver, ms, in.GroupBy, in.GroupWait, in.GroupInterval, in.RepeatInterval)
+	if err != nil {
+		return nil, err
+	}
+	route.Continue = in.Continue
+	route.MuteTimeIntervals = in.MuteTimeIntervals
+
+	for _, child := range in.Routes {
+		r, err := vmDecodeRoute(receiver, child)
+		if err != nil {
+			return nil, err
+		}
+		route.Routes = append(route.Routes, r)
+	}
+
+	return route, nil
+}
+
+func (vmAlertmanagerConfigAPI) encode(obj client.Object, rc *receiverConfig) error {
+	c := obj.(*vm.VMAlertmanagerConfig)
+
+	routes := make([]*vm.Route, 0, len(rc.routes))
+	for _, r := range rc.routes {
+		routes = append(routes, vmEncodeRoute(r))
+	}
+
+	c.Spec.MutTimeIntervals = nil
+	for _, mt := range rc.muteTimeIntervals {
+		mti := vm.MuteTimeInterval{Name: mt.Name}
+		if err := convertTimeIntervals(mt.TimeIntervals, &mti.TimeIntervals); err != nil {
+			return fmt.Errorf("failed to convert time interval %s: %s", mt.Name, err)
+		}
+		c.Spec.MutTimeIntervals = append(c.Spec.MutTimeIntervals, mti)
+	}
+
+	url, sendResolved := rc.url, rc.sendResolved
+	c.Spec.Route = &vm.Route{Receiver: nullReceiver, Routes: routes}
+	c.Spec.Receivers = []vm.Receiver{
+		{Name: nullReceiver},
+		{Name: crdReceiver, WebhookConfigs: []vm.WebhookConfig{{URL: &url, SendResolved: &sendResolved}}},
+	}
+
+	return nil
+}
+
+func vmEncodeRoute(r *amcfg.Route) *vm.Route {
+	out := &vm.Route{
+		Receiver:          crdReceiver,
+		GroupBy:           r.GroupByStr,
+		GroupWait:         durationString(r.GroupWait),
+		GroupInterval:     durationString(r.GroupInterval),
+		RepeatInterval:    durationString(r.RepeatInterval),
+		Continue:          r.Continue,
+		MuteTimeIntervals: r.MuteTimeIntervals,
+	}
+	for _, m := range routeMatchers(r) {
+		out.Matchers = append(out.Matchers, m.String())
+	}
+	for _, child := range r.Routes {
+		out.Routes = append(out.Routes, vmEncodeRoute(child))
+	}
+
+	return out
+}
+
+// convertTimeIntervals converts time intervals between alertmanager and operator types,
+// which have the same json representation
+func convertTimeIntervals(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+func (vmAlertmanagerConfigAPI) separator() string {
+	return "-"
+}
+
+func (vmAlertmanagerConfigAPI) muteTimeIntervals() bool {
+	return true
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	amcfg "github.com/prometheus/alertmanager/config"
+)
+
+// isBotReceiver returns true for receivers managed by bot
+func isBotReceiver(name string) bool {
+	if name == BotRouteReceiver {
+		return true
+	}
+
+	receiver, err := strconv.ParseInt(strings.TrimPrefix(name, ReceiverPrefix), 10, 64)
+
+	return err == nil && name == botReceiverName(receiver)
+}
+
+// merge returns manual config extended with bot receivers, time intervals and route from dest config.
+// Manual receivers and routes are kept as is, bot route is placed before manual
+// top level routes and always continues matching, so manual routes get all alerts too.
+func merge(dest, manual *amcfg.Config) (*amcfg.Config, error) {
+	for _, r := range manual.Receivers {
+		if isBotReceiver(r.Name) {
+			return nil, fmt.Errorf("receiver %s from manual config collides with bot receivers names", r.Name)
+		}
+	}
+
+	for _, mt := range manual.MuteTimeIntervals {
+		if isBotTimeInterval(mt.Name) {
+			return nil, fmt.Errorf("time interval %s from manual config collides with bot time intervals names", mt.Name)
+		}
+	}
+
+	var receivers []*amcfg.Receiver
+	for _, r := range dest.Receivers {
+		if isBotReceiver(r.Name) {
+			receivers = append(receivers, r)
+		}
+	}
+
+	var intervals []amcfg.MuteTimeInterval
+	for _, mt := range dest.MuteTimeIntervals {
+		if isBotTimeInterval(mt.Name) {
+			intervals = append(intervals, mt)
+		}
+	}
+
+	var routes []*amcfg.Route
+	for _, r := range dest.Route.Routes {
+		if r.Receiver == BotRouteReceiver {
+			r.Continue = true
+			routes = append(routes, r)
+		}
+	}
+
+	out := *manual
+	route := *manual.Route
+	out.Route = &route
+	out.Route.Routes = append(routes, manual.Route.Routes...)
+	out.Receivers = append(append([]*amcfg.Receiver{}, manual.Receivers...), receivers...)
+	out.MuteTimeIntervals = append(append([]amcfg.MuteTimeInterval{}, manual.MuteTimeIntervals...), intervals...)
+
+	return &out, nil
+}
+
+// migrate moves top level routes of receivers with numeric names, created by
+// previous bot versions, under bot route and renames these receivers with bot prefix.
+// Migration is done once, before bot route is created, and only receivers sending
+// notifications to given bot webhook url are migrated. It returns true if config was changed.
+func migrate(conf *amcfg.Config, webhook string) bool {
+	if findBotRoute(conf) != nil {
+		return false
+	}
+
+	legacy := make(map[string]bool)
+	for _, r := range conf.Receivers {
+		if _, err := strconv.ParseInt(r.Name, 10, 64); err != nil {
+			continue
+		}
+		for _, wc := range r.WebhookConfigs {
+			if wc.URL != nil && wc.URL.URL != nil && wc.URL.String() == webhook {
+				legacy[r.Name] = true
+			}
+		}
+	}
+	if len(legacy) == 0 {
+		return false
+	}
+
+	for _, r := range conf.Receivers {
+		if legacy[r.Name] {
+			r.Name = ReceiverPrefix + r.Name
+		}
+	}
+
+	var routes, moved []*amcfg.Route
+	for _, r := range conf.Route.Routes {
+		if legacy[r.Receiver] {
+			r.Receiver = ReceiverPrefix + r.Receiver
+			// bot routes always continue, so chats get alerts of all their subscriptions
+			r.Continue = true
+			moved = append(moved, r)
+
+			continue
+		}
+		routes = append(routes, r)
+	}
+
+	conf.Route.Routes = routes
+	br := botRoute(conf)
+	br.Routes = append(br.Routes, moved...)
+
+	return true
+}
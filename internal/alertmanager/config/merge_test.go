@@ -0,0 +1,395 @@
+package config
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	amcfg "github.com/prometheus/alertmanager/config"
+)
+
+const testDestConfig = `
+route:
+  receiver: default
+receivers:
+- name: default
+`
+
+func loadTestConfig(t *testing.T, data string) *amcfg.Config {
+	t.Helper()
+
+	conf, err := amcfg.Load(data)
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+
+	return conf
+}
+
+func writeTestFile(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "alertmanager.yml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+
+	return path
+}
+
+func newTestConfig(t *testing.T, dest, manual string) (*Config, string) {
+	t.Helper()
+
+	wu, _ := url.Parse("http://bot:8000/webhook")
+	path := writeTestFile(t, dest)
+	var ms Storage
+	if manual != "" {
+		ms = NewFileStorage(writeTestFile(t, manual))
+	}
+
+	return New(NewFileStorage(path), ms, wu), path
+}
+
+func TestMerge(t *testing.T) {
+	dest := `
+route:
+  receiver: default
+  routes:
+  - receiver: tg-bot
+    routes:
+    - receiver: tg-100
+      continue: true
+receivers:
+- name: default
+- name: tg-bot
+- name: tg-100
+  webhook_configs:
+  - url: http://bot:8000/webhook
+mute_time_intervals:
+- name: tg-100-quiet
+  time_intervals:
+  - weekdays: [saturday]
+`
+
+	tests := []struct {
+		name      string
+		manual    string
+		err       string
+		receivers []string
+		routes    []string
+		intervals []string
+	}{
+		{
+			name: "manual receivers and routes are kept",
+			manual: `
+route:
+  receiver: ops
+  routes:
+  - receiver: ops
+    match:
+      team: ops
+receivers:
+- name: ops
+mute_time_intervals:
+- name: weekends
+  time_intervals:
+  - weekdays: [saturday, sunday]
+`,
+			receivers: []string{"ops", "tg-bot", "tg-100"},
+			routes:    []string{"tg-bot", "ops"},
+			intervals: []string{"weekends", "tg-100-quiet"},
+		},
+		{
+			name: "names with bot prefix, which bot doesn't generate, are allowed",
+			manual: `
+route:
+  receiver: tg-ops
+receivers:
+- name: tg-ops
+- name: tg-007
+mute_time_intervals:
+- name: tg-ops-quiet
+  time_intervals:
+  - weekdays: [sunday]
+`,
+			receivers: []string{"tg-ops", "tg-007", "tg-bot", "tg-100"},
+			routes:    []string{"tg-bot"},
+			intervals: []string{"tg-ops-quiet", "tg-100-quiet"},
+		},
+		{
+			name: "receiver collides with bot receiver",
+			manual: `
+route:
+  receiver: tg-200
+receivers:
+- name: tg-200
+`,
+			err: "receiver tg-200 from manual config collides",
+		},
+		{
+			name: "receiver collides with bot route receiver",
+			manual: `
+route:
+  receiver: default
+receivers:
+- name: default
+- name: tg-bot
+`,
+			err: "receiver tg-bot from manual config collides",
+		},
+		{
+			name: "time interval collides with bot quiet hours",
+			manual: `
+route:
+  receiver: default
+receivers:
+- name: default
+mute_time_intervals:
+- name: tg-100-quiet-except-critical
+  time_intervals:
+  - weekdays: [sunday]
+`,
+			err: "time interval tg-100-quiet-except-critical from manual config collides",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := merge(loadTestConfig(t, dest), loadTestConfig(t, tt.manual))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var receivers, routes, intervals []string
+			for _, r := range conf.Receivers {
+				receivers = append(receivers, r.Name)
+			}
+			for _, r := range conf.Route.Routes {
+				routes = append(routes, r.Receiver)
+			}
+			for _, mt := range conf.MuteTimeIntervals {
+				intervals = append(intervals, mt.Name)
+			}
+
+			if strings.Join(receivers, ",") != strings.Join(tt.receivers, ",") {
+				t.Errorf("expected receivers %v, got %v", tt.receivers, receivers)
+			}
+			if strings.Join(routes, ",") != strings.Join(tt.routes, ",") {
+				t.Errorf("expected routes %v, got %v", tt.routes, routes)
+			}
+			if strings.Join(intervals, ",") != strings.Join(tt.intervals, ",") {
+				t.Errorf("expected time intervals %v, got %v", tt.intervals, intervals)
+			}
+			if !findBotRoute(conf).Continue {
+				t.Errorf("bot route must continue")
+			}
+		})
+	}
+}
+
+func TestIsBotReceiver(t *testing.T) {
+	tests := map[string]bool{
+		"tg-bot":  true,
+		"tg-100":  true,
+		"tg--100": true,
+		"tg-007":  false,
+		"tg-+100": false,
+		"tg-ops":  false,
+		"100":     false,
+		"default": false,
+	}
+
+	for name, want := range tests {
+		if got := isBotReceiver(name); got != want {
+			t.Errorf("isBotReceiver(%q) = %t, expected %t", name, got, want)
+		}
+	}
+}
+
+func TestUpdateKeepsSecrets(t *testing.T) {
+	manual := `
+global:
+  slack_api_url: https://hooks.slack.com/services/global-secret
+route:
+  receiver: slack
+  routes:
+  - receiver: pager
+    matchers: [severity="critical"]
+receivers:
+- name: slack
+  slack_configs:
+  - channel: '#alerts'
+- name: pager
+  pagerduty_configs:
+  - routing_key: pagerduty-secret
+    http_config:
+      basic_auth:
+        username: user
+        password: basic-auth-secret
+`
+
+	tests := []struct {
+		name, dest, manual string
+	}{
+		{"manual config", testDestConfig, manual},
+		{"destination config", manual, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, path := newTestConfig(t, tt.dest, tt.manual)
+
+			if _, err := c.RegisterReceiver(100); err != nil {
+				t.Fatalf("failed to register receiver: %s", err)
+			}
+			if _, err := c.AddRoute(100, nil); err != nil {
+				t.Fatalf("failed to add route: %s", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, secret := range []string{"global-secret", "pagerduty-secret", "basic-auth-secret"} {
+				if !strings.Contains(string(data), secret) {
+					t.Errorf("secret %s is lost in written config:\n%s", secret, data)
+				}
+			}
+			if strings.Contains(string(data), "<secret>") {
+				t.Errorf("written config contains masked secrets:\n%s", data)
+			}
+
+			conf := loadTestConfig(t, string(data))
+			if conf.Route.Routes[0].Receiver != BotRouteReceiver || conf.Route.Routes[1].Receiver != "pager" {
+				t.Errorf("unexpected routes order in written config:\n%s", data)
+			}
+			if getReceiverPosition(conf.Receivers, "tg-100") == -1 {
+				t.Errorf("bot receiver is missing in written config:\n%s", data)
+			}
+		})
+	}
+}
+
+func TestUpdateMigratesLegacyReceivers(t *testing.T) {
+	c, path := newTestConfig(t, `
+route:
+  receiver: default
+  routes:
+  - receiver: default
+    match:
+      team: ops
+  - receiver: "100"
+    continue: true
+receivers:
+- name: default
+- name: "100"
+  webhook_configs:
+  - url: http://bot:8000/webhook
+`, "")
+
+	if err := c.Sync(); err != nil {
+		t.Fatalf("failed to sync config: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := loadTestConfig(t, string(data))
+
+	if len(conf.Route.Routes) != 2 || conf.Route.Routes[0].Receiver != BotRouteReceiver || conf.Route.Routes[1].Receiver != "default" {
+		t.Fatalf("unexpected top level routes:\n%s", data)
+	}
+	if br := conf.Route.Routes[0]; len(br.Routes) != 1 || br.Routes[0].Receiver != "tg-100" {
+		t.Errorf("legacy route isn't moved under bot route:\n%s", data)
+	}
+	if getReceiverPosition(conf.Receivers, "100") != -1 || getReceiverPosition(conf.Receivers, "tg-100") == -1 {
+		t.Errorf("legacy receiver isn't renamed:\n%s", data)
+	}
+}
+
+func TestMigrateKeepsOtherNumericReceivers(t *testing.T) {
+	c, path := newTestConfig(t, `
+route:
+  receiver: default
+  routes:
+  - receiver: "911"
+    match:
+      severity: critical
+  - receiver: "100"
+receivers:
+- name: default
+- name: "911"
+  email_configs:
+  - to: oncall@example.org
+    from: alertmanager@example.org
+    smarthost: smtp.example.org:25
+- name: "100"
+  webhook_configs:
+  - url: http://bot:8000/webhook
+`, "")
+
+	if err := c.Sync(); err != nil {
+		t.Fatalf("failed to sync config: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := loadTestConfig(t, string(data))
+
+	if len(conf.Route.Routes) != 2 || conf.Route.Routes[1].Receiver != "911" || conf.Route.Routes[1].Match["severity"] != "critical" {
+		t.Fatalf("numeric receiver of user is changed:\n%s", data)
+	}
+	if br := conf.Route.Routes[0]; br.Receiver != BotRouteReceiver || len(br.Routes) != 1 || br.Routes[0].Receiver != "tg-100" || !br.Routes[0].Continue {
+		t.Errorf("legacy route isn't moved under bot route with continue:\n%s", data)
+	}
+	if ok, _ := c.IsReceiverExists(911); ok {
+		t.Errorf("numeric receiver of user is treated as bot receiver")
+	}
+	if ok, _ := c.IsReceiverExists(100); !ok {
+		t.Errorf("legacy receiver isn't migrated")
+	}
+}
+
+func TestMigrateOnce(t *testing.T) {
+	// numeric webhook receiver, which is added after migration, is kept as is
+	c, path := newTestConfig(t, `
+route:
+  receiver: default
+  routes:
+  - receiver: tg-bot
+    continue: true
+  - receiver: "200"
+receivers:
+- name: default
+- name: tg-bot
+- name: "200"
+  webhook_configs:
+  - url: http://bot:8000/webhook
+`, "")
+
+	if err := c.Sync(); err != nil {
+		t.Fatalf("failed to sync config: %s", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := loadTestConfig(t, string(data))
+
+	if getReceiverPosition(conf.Receivers, "200") == -1 || len(conf.Route.Routes) != 2 || conf.Route.Routes[1].Receiver != "200" {
+		t.Errorf("receiver is migrated again:\n%s", data)
+	}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"strings"
+
+	amcfg "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/timeinterval"
+)
+
+const (
+	// suffixes of receiver quiet hours time interval name,
+	// the second one means critical alerts are exempt from quiet hours
+	quietSuffix               = "-quiet"
+	quietExceptCriticalSuffix = "-quiet-except-critical"
+)
+
+// criticalMatchers match alerts, which may be exempt from quiet hours
+var criticalMatchers = amcfg.Matchers{{Type: labels.MatchEqual, Name: "severity", Value: "critical"}}
+
+// QuietHours returns time intervals, when receiver notifications are muted,
+// and true if critical alerts are exempt from these intervals
+func (c *Config) QuietHours(receiver int64) ([]timeinterval.TimeInterval, bool, error) {
+	conf, err := c.Get()
+	if err != nil {
+		return nil, false, err
+	}
+
+	for _, mt := range conf.MuteTimeIntervals {
+		switch mt.Name {
+		case botReceiverName(receiver) + quietSuffix:
+			return mt.TimeIntervals, false, nil
+		case botReceiverName(receiver) + quietExceptCriticalSuffix:
+			return mt.TimeIntervals, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+// SetQuietHours mutes receiver notifications in given time intervals,
+// quiet hours are removed if intervals are empty
+func (c *Config) SetQuietHours(receiver int64, intervals []timeinterval.TimeInterval, exceptCritical bool) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		r := botReceiverName(receiver)
+		if getReceiverPosition(conf.Receivers, r) == -1 {
+			return ErrNotFound
+		}
+
+		conf.MuteTimeIntervals = removeQuietHours(conf.MuteTimeIntervals, receiver)
+
+		name := ""
+		if len(intervals) > 0 {
+			name = r + quietSuffix
+			if exceptCritical {
+				name = r + quietExceptCriticalSuffix
+			}
+
+			conf.MuteTimeIntervals = append(conf.MuteTimeIntervals, amcfg.MuteTimeInterval{
+				Name:          name,
+				TimeIntervals: intervals,
+			})
+		}
+
+		for _, route := range botRoute(conf).Routes {
+			if route.Receiver == r {
+				applyQuietHours(route, name)
+			}
+		}
+
+		return nil
+	})
+}
+
+// removeQuietHours returns time intervals without receiver quiet hours
+func removeQuietHours(in []amcfg.MuteTimeInterval, receiver int64) []amcfg.MuteTimeInterval {
+	var out []amcfg.MuteTimeInterval
+	for _, mt := range in {
+		if quietHoursReceiver(mt.Name) != botReceiverName(receiver) {
+			out = append(out, mt)
+		}
+	}
+
+	return out
+}
+
+// applyQuietHours mutes route in time interval with given name. Critical alerts are routed
+// to child route without mute time intervals, if they are exempt from quiet hours.
+func applyQuietHours(route *amcfg.Route, name string) {
+	route.MuteTimeIntervals = nil
+	route.Routes = nil
+
+	if name == "" {
+		return
+	}
+
+	route.MuteTimeIntervals = []string{name}
+	if strings.HasSuffix(name, quietExceptCriticalSuffix) {
+		route.Routes = []*amcfg.Route{{Receiver: route.Receiver, Matchers: criticalMatchers}}
+	}
+}
+
+// inheritQuietHours applies receiver quiet hours to given route
+func inheritQuietHours(conf *amcfg.Config, route *amcfg.Route) {
+	for _, mt := range conf.MuteTimeIntervals {
+		if quietHoursReceiver(mt.Name) == route.Receiver {
+			applyQuietHours(route, mt.Name)
+
+			return
+		}
+	}
+}
+
+// quietHoursReceiver returns name of receiver muted by time interval
+// with given name or empty string, if it isn't quiet hours interval
+func quietHoursReceiver(name string) string {
+	for _, suffix := range []string{quietExceptCriticalSuffix, quietSuffix} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+
+	return ""
+}
+
+// isBotTimeInterval returns true for time intervals managed by bot
+func isBotTimeInterval(name string) bool {
+	return isBotReceiver(quietHoursReceiver(name))
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"fmt"
+
+	amcfg "github.com/prometheus/alertmanager/config"
+	"gopkg.in/yaml.v2"
+)
+
+// render returns config data, where bot receivers, routes and time intervals
+// are generated from conf and everything else is taken from base data as is.
+// Alertmanager config marshaling masks secrets, so receivers not managed
+// by bot must not be serialized from the parsed config.
+func render(base []byte, conf *amcfg.Config) (string, error) {
+	gen, err := yaml.Marshal(conf)
+	if err != nil {
+		return "", fmt.Errorf("failed marshal config: %s", err)
+	}
+
+	var generated, out yaml.MapSlice
+	if err := yaml.Unmarshal(gen, &generated); err != nil {
+		return "", fmt.Errorf("failed unmarshal generated config: %s", err)
+	}
+	if err := yaml.Unmarshal(base, &out); err != nil {
+		return "", fmt.Errorf("failed unmarshal base config: %s", err)
+	}
+
+	receivers := mergeNamed(yamlList(out, "receivers"), yamlList(generated, "receivers"), isBotReceiver)
+	names := make([]string, 0, len(conf.Receivers))
+	for _, r := range conf.Receivers {
+		names = append(names, r.Name)
+	}
+	if receivers, err = orderNamed(receivers, names); err != nil {
+		return "", fmt.Errorf("failed render receivers: %s", err)
+	}
+	out = yamlSet(out, "receivers", receivers)
+
+	intervals := mergeNamed(yamlList(out, "mute_time_intervals"), yamlList(generated, "mute_time_intervals"), isBotTimeInterval)
+	names = make([]string, 0, len(conf.MuteTimeIntervals))
+	for _, mt := range conf.MuteTimeIntervals {
+		names = append(names, mt.Name)
+	}
+	if intervals, err = orderNamed(intervals, names); err != nil {
+		return "", fmt.Errorf("failed render time intervals: %s", err)
+	}
+	out = yamlSet(out, "mute_time_intervals", intervals)
+
+	route, _ := yamlGet(out, "route").(yaml.MapSlice)
+	genRoute, _ := yamlGet(generated, "route").(yaml.MapSlice)
+	routes, err := renderRoutes(yamlList(route, "routes"), yamlList(genRoute, "routes"), conf)
+	if err != nil {
+		return "", fmt.Errorf("failed render routes: %s", err)
+	}
+	out = yamlSet(out, "route", yamlSet(route, "routes", routes))
+
+	data, err := yaml.Marshal(out)
+	if err != nil {
+		return "", fmt.Errorf("failed marshal config: %s", err)
+	}
+
+	return string(data), nil
+}
+
+// mergeNamed returns base items, which aren't managed by bot, and generated bot items
+func mergeNamed(base, generated []interface{}, managed func(string) bool) []interface{} {
+	var out []interface{}
+	for _, item := range base {
+		if !managed(yamlString(item, "name")) {
+			out = append(out, item)
+		}
+	}
+	for _, item := range generated {
+		if managed(yamlString(item, "name")) {
+			out = append(out, item)
+		}
+	}
+
+	return out
+}
+
+// orderNamed returns items with given names in the same order, items with
+// other names are dropped, e.g. receivers renamed by migration
+func orderNamed(items []interface{}, names []string) ([]interface{}, error) {
+	byName := make(map[string]interface{}, len(items))
+	for _, item := range items {
+		byName[yamlString(item, "name")] = item
+	}
+
+	out := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		item, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%q is missing", name)
+		}
+		out = append(out, item)
+	}
+
+	return out, nil
+}
+
+// renderRoutes returns top level routes in order of conf routes. Bot route is generated,
+// other routes are taken from base in the same order, routes of legacy bot receivers
+// are moved under bot route by migration, so they are skipped.
+func renderRoutes(base, generated []interface{}, conf *amcfg.Config) ([]interface{}, error) {
+	var br interface{}
+	for _, item := range generated {
+		if yamlString(item, "receiver") == BotRouteReceiver {
+			br = item
+		}
+	}
+
+	var manual []interface{}
+	for _, item := range base {
+		r := yamlString(item, "receiver")
+		if r == BotRouteReceiver {
+			continue
+		}
+		if r != "" && getReceiverPosition(conf.Receivers, r) == -1 {
+			continue
+		}
+		manual = append(manual, item)
+	}
+
+	out := make([]interface{}, 0, len(conf.Route.Routes))
+	for _, r := range conf.Route.Routes {
+		if r.Receiver == BotRouteReceiver {
+			if br == nil {
+				return nil, fmt.Errorf("bot route is missing")
+			}
+			out = append(out, br)
+
+			continue
+		}
+
+		if len(manual) == 0 || yamlString(manual[0], "receiver") != r.Receiver {
+			return nil, fmt.Errorf("route of receiver %q is missing", r.Receiver)
+		}
+		out = append(out, manual[0])
+		manual = manual[1:]
+	}
+	if len(manual) > 0 {
+		return nil, fmt.Errorf("%d unexpected routes", len(manual))
+	}
+
+	return out, nil
+}
+
+func yamlGet(in yaml.MapSlice, key string) interface{} {
+	for _, item := range in {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+
+	return nil
+}
+
+// yamlSet sets value of given key, key is removed if value is empty list
+func yamlSet(in yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	if l, ok := value.([]interface{}); ok && len(l) == 0 {
+		out := make(yaml.MapSlice, 0, len(in))
+		for _, item := range in {
+			if item.Key != key {
+				out = append(out, item)
+			}
+		}
+
+		return out
+	}
+
+	for i, item := range in {
+		if item.Key == key {
+			in[i].Value = value
+
+			return in
+		}
+	}
+
+	return append(in, yaml.MapItem{Key: key, Value: value})
+}
+
+func yamlList(in yaml.MapSlice, key string) []interface{} {
+	l, _ := yamlGet(in, key).([]interface{})
+
+	return l
+}
+
+func yamlString(in interface{}, key string) string {
+	m, _ := in.(yaml.MapSlice)
+	s, _ := yamlGet(m, key).(string)
+
+	return s
+}
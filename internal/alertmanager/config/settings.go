@@ -0,0 +1,122 @@
+package config
+
+import (
+	"reflect"
+
+	amcfg "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/common/model"
+)
+
+// RouteSettings are notification settings of route, empty values are inherited from parent route
+type RouteSettings struct {
+	GroupBy        []string
+	GroupWait      *model.Duration
+	GroupInterval  *model.Duration
+	RepeatInterval *model.Duration
+}
+
+// GetRouteSettings returns notification settings of given route
+func GetRouteSettings(r *amcfg.Route) RouteSettings {
+	return RouteSettings{
+		GroupBy:        r.GroupByStr,
+		GroupWait:      r.GroupWait,
+		GroupInterval:  r.GroupInterval,
+		RepeatInterval: r.RepeatInterval,
+	}
+}
+
+func (s RouteSettings) apply(r *amcfg.Route) {
+	r.GroupByStr = s.GroupBy
+	r.GroupWait = s.GroupWait
+	r.GroupInterval = s.GroupInterval
+	r.RepeatInterval = s.RepeatInterval
+}
+
+// UpdateRouteSettings changes notification settings of receiver route with given name,
+// settings of all receiver routes are changed if name is empty
+func (c *Config) UpdateRouteSettings(receiver int64, name string, update func(s *RouteSettings)) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		var found bool
+		for _, r := range listRoutes(botRoute(conf).Routes, botReceiverName(receiver)) {
+			if name != "" && r.name != name {
+				continue
+			}
+
+			route := botRoute(conf).Routes[r.index]
+			s := GetRouteSettings(route)
+			update(&s)
+			s.apply(route)
+			found = true
+		}
+
+		if !found {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+}
+
+// SendResolved returns true if receiver is notified about resolved alerts
+func (c *Config) SendResolved(receiver int64) (bool, error) {
+	conf, err := c.Get()
+	if err != nil {
+		return false, err
+	}
+
+	p := getReceiverPosition(conf.Receivers, botReceiverName(receiver))
+	if p == -1 {
+		return false, ErrNotFound
+	}
+
+	for _, wh := range conf.Receivers[p].WebhookConfigs {
+		return wh.SendResolved(), nil
+	}
+
+	return false, nil
+}
+
+// SetSendResolved changes receiver notifications about resolved alerts
+func (c *Config) SetSendResolved(receiver int64, value bool) (*Change, error) {
+	return c.update(func(conf *amcfg.Config) error {
+		p := getReceiverPosition(conf.Receivers, botReceiverName(receiver))
+		if p == -1 {
+			return ErrNotFound
+		}
+
+		rc := conf.Receivers[p]
+		for i, wh := range rc.WebhookConfigs {
+			// webhook configs may be shared with other receivers, so they are copied
+			v := *wh
+			v.VSendResolved = value
+			rc.WebhookConfigs[i] = &v
+		}
+
+		return nil
+	})
+}
+
+// inheritSettings copies settings shared by all receiver routes into given route,
+// so settings changed for whole chat are applied to its new subscriptions too
+func inheritSettings(routes []*amcfg.Route, route *amcfg.Route) {
+	var shared *RouteSettings
+	for _, r := range routes {
+		if r.Receiver != route.Receiver {
+			continue
+		}
+
+		s := GetRouteSettings(r)
+		if shared == nil {
+			shared = &s
+
+			continue
+		}
+		if !reflect.DeepEqual(*shared, s) {
+			return
+		}
+	}
+
+	if shared != nil {
+		shared.apply(route)
+	}
+}
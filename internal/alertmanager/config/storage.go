@@ -0,0 +1,188 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/storage"
+)
+
+const (
+	// key of alertmanager config in secrets and configmaps
+	ConfigKey = "alertmanager.yaml"
+)
+
+var (
+	// ErrConflict is returned by storage, when config was changed after reading
+	ErrConflict = errors.New("config was changed concurrently")
+)
+
+// Storage reads and writes raw alertmanager config. Read returns config
+// with its revision, Write saves config only if stored revision is still
+// the same, otherwise ErrConflict is returned.
+type Storage interface {
+	Read() (data []byte, revision string, err error)
+	Write(data []byte, revision string) error
+}
+
+// receiverNamer is implemented by storages, which receivers are renamed
+// in resulting alertmanager config
+type receiverNamer interface {
+	ReceiverName(receiver string) string
+	ParseReceiverName(name string) (string, bool)
+}
+
+// selfReloader is implemented by storages, which changes are applied
+// to alertmanager by someone else
+type selfReloader interface {
+	SelfReloading() bool
+}
+
+// quietHoursLimiter is implemented by storages, which may not keep
+// mute time intervals of quiet hours
+type quietHoursLimiter interface {
+	QuietHoursSupported() bool
+}
+
+type secretStorage struct {
+	key types.NamespacedName
+	kc  client.Client
+}
+
+// NewSecretStorage returns storage keeping config in kubernetes secret
+func NewSecretStorage(namespace, name string, kc client.Client) Storage {
+	return &secretStorage{key: types.NamespacedName{Namespace: namespace, Name: name}, kc: kc}
+}
+
+func (s *secretStorage) Read() ([]byte, string, error) {
+	secret := &v1.Secret{}
+	if err := s.kc.Get(context.Background(), s.key, secret); err != nil {
+		return nil, "", fmt.Errorf("failed to get secret %s: %s", s.key, err)
+	}
+
+	data, ok := secret.Data[ConfigKey]
+	if !ok {
+		return nil, "", fmt.Errorf("secret %s not contain %s file", s.key, ConfigKey)
+	}
+
+	return data, secret.ResourceVersion, nil
+}
+
+func (s *secretStorage) Write(data []byte, revision string) error {
+	secret := &v1.Secret{}
+	if err := s.kc.Get(context.Background(), s.key, secret); err != nil {
+		return fmt.Errorf("failed to get secret %s: %s", s.key, err)
+	}
+
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	secret.Data[ConfigKey] = data
+	secret.ResourceVersion = revision
+
+	err := s.kc.Update(context.Background(), secret)
+	if apierrors.IsConflict(err) {
+		return ErrConflict
+	} else if err != nil {
+		return fmt.Errorf("failed to update secret %s: %s", s.key, err)
+	}
+
+	return nil
+}
+
+type configMapStorage struct {
+	key types.NamespacedName
+	kc  client.Client
+}
+
+// NewConfigMapStorage returns storage keeping config in kubernetes configmap
+func NewConfigMapStorage(namespace, name string, kc client.Client) Storage {
+	return &configMapStorage{key: types.NamespacedName{Namespace: namespace, Name: name}, kc: kc}
+}
+
+func (s *configMapStorage) Read() ([]byte, string, error) {
+	cm := &v1.ConfigMap{}
+	if err := s.kc.Get(context.Background(), s.key, cm); err != nil {
+		return nil, "", fmt.Errorf("failed to get configmap %s: %s", s.key, err)
+	}
+
+	data, ok := cm.Data[ConfigKey]
+	if !ok {
+		return nil, "", fmt.Errorf("configmap %s not contain %s file", s.key, ConfigKey)
+	}
+
+	return []byte(data), cm.ResourceVersion, nil
+}
+
+func (s *configMapStorage) Write(data []byte, revision string) error {
+	cm := &v1.ConfigMap{}
+	if err := s.kc.Get(context.Background(), s.key, cm); err != nil {
+		return fmt.Errorf("failed to get configmap %s: %s", s.key, err)
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[ConfigKey] = string(data)
+	cm.ResourceVersion = revision
+
+	err := s.kc.Update(context.Background(), cm)
+	if apierrors.IsConflict(err) {
+		return ErrConflict
+	} else if err != nil {
+		return fmt.Errorf("failed to update configmap %s: %s", s.key, err)
+	}
+
+	return nil
+}
+
+type fileStorage struct {
+	path string
+}
+
+// NewFileStorage returns storage keeping config in local file,
+// content hash is used as revision
+func NewFileStorage(path string) Storage {
+	return &fileStorage{path: path}
+}
+
+func (s *fileStorage) Read() ([]byte, string, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read config file: %s", err)
+	}
+
+	return data, fileRevision(data), nil
+}
+
+func (s *fileStorage) Write(data []byte, revision string) error {
+	current, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %s", err)
+	}
+
+	if fileRevision(current) != revision {
+		return ErrConflict
+	}
+
+	if err := storage.WriteFile(s.path, data); err != nil {
+		return fmt.Errorf("failed to write config file: %s", err)
+	}
+
+	return nil
+}
+
+func fileRevision(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
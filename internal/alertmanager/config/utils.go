@@ -1,26 +1,112 @@
 package config
 
 import (
+	"sort"
+	"strconv"
+	"strings"
+
 	amcfg "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+)
+
+const (
+	// prefix of bot receivers names
+	ReceiverPrefix = "tg-"
+	// receiver of route, which contains all bot routes. It has no
+	// notification configs, so it drops alerts not matched by bot routes.
+	BotRouteReceiver = ReceiverPrefix + "bot"
 )
 
 type route struct {
 	index    int64
 	receiver string
 	match    map[string]string
+	matchers amcfg.Matchers
+	name     string
 }
 
 func listRoutes(in []*amcfg.Route, receiver string) []route {
 	out := make([]route, 0)
 	for index, value := range in {
 		if value.Receiver == receiver {
-			out = append(out, route{int64(index), value.Receiver, value.Match})
+			out = append(out, route{int64(index), value.Receiver, value.Match, value.Matchers, RouteName(value)})
 		}
 	}
 
 	return out
 }
 
+// RouteName returns human readable route name: alert group name
+// for alert group subscriptions and matchers string for others
+func RouteName(r *amcfg.Route) string {
+	if group, ok := r.Match["alertgroup"]; ok && len(r.Match) == 1 && len(r.MatchRE) == 0 && len(r.Matchers) == 0 {
+		return group
+	}
+
+	ms := routeMatchers(r)
+	sort.Sort(ms)
+
+	return ms.String()
+}
+
+// routeMatchers returns all route matchers, including deprecated match and match_re ones
+func routeMatchers(r *amcfg.Route) labels.Matchers {
+	ms := make(labels.Matchers, 0)
+	for k, v := range r.Match {
+		if m, err := labels.NewMatcher(labels.MatchEqual, k, v); err == nil {
+			ms = append(ms, m)
+		}
+	}
+	for k, v := range r.MatchRE {
+		// regexps are stored anchored
+		re := strings.TrimSuffix(strings.TrimPrefix(v.String(), "^(?:"), ")$")
+		if m, err := labels.NewMatcher(labels.MatchRegexp, k, re); err == nil {
+			ms = append(ms, m)
+		}
+	}
+	ms = append(ms, r.Matchers...)
+
+	return ms
+}
+
+func botReceiverName(receiver int64) string {
+	return ReceiverPrefix + strconv.FormatInt(receiver, 10)
+}
+
+// botRoute returns route containing all bot routes, route and its
+// receiver are created, if they don't exist yet
+func botRoute(conf *amcfg.Config) *amcfg.Route {
+	if getReceiverPosition(conf.Receivers, BotRouteReceiver) == -1 {
+		conf.Receivers = append(conf.Receivers, &amcfg.Receiver{Name: BotRouteReceiver})
+	}
+
+	if r := findBotRoute(conf); r != nil {
+		return r
+	}
+
+	// bot route is the first one and always continues,
+	// so other routes get all alerts too
+	r := &amcfg.Route{Receiver: BotRouteReceiver, Continue: true}
+	conf.Route.Routes = append([]*amcfg.Route{r}, conf.Route.Routes...)
+
+	return r
+}
+
+// findBotRoute returns route containing all bot routes or nil, if it doesn't exist
+func findBotRoute(conf *amcfg.Config) *amcfg.Route {
+	for _, value := range conf.Route.Routes {
+		if value.Receiver == BotRouteReceiver {
+			return value
+		}
+	}
+
+	return nil
+}
+
+func isCatchAllRoute(r route) bool {
+	return r.match == nil && len(r.matchers) == 0
+}
+
 func getReceiverPosition(receivers []*amcfg.Receiver, receiver string) int64 {
 	for index, value := range receivers {
 		if value.Name == receiver {
@@ -42,7 +128,7 @@ func getRoutePosition(in []*amcfg.Route, receiver string, match map[string]strin
 				}
 			}
 		} else {
-			if value.match == nil {
+			if isCatchAllRoute(value) {
 				return value.index
 			}
 		}
@@ -62,3 +148,14 @@ func removeAllRoutes(in []*amcfg.Route, receiver string) []*amcfg.Route {
 
 	return out
 }
+
+// get position of route with given name in config file
+func getRoutePositionByName(in []*amcfg.Route, receiver, name string) int64 {
+	for _, value := range listRoutes(in, receiver) {
+		if value.name == name {
+			return value.index
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+
+	amcfg "github.com/prometheus/alertmanager/config"
+)
+
+// ValidationError is returned, when generated config is rejected
+// by alertmanager config checks and hasn't been written
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("generated alertmanager config is invalid: %s", e.Err)
+}
+
+// validate loads rendered config data the same way alertmanager does,
+// so receiver references, matchers syntax, time intervals etc. are checked
+func validate(conf *amcfg.Config, data string) error {
+	loaded, err := amcfg.Load(data)
+	if err != nil {
+		return &ValidationError{Err: err}
+	}
+
+	// routes and receivers must survive serialization, otherwise
+	// subscriptions would be silently lost
+	if len(loaded.Receivers) != len(conf.Receivers) {
+		return &ValidationError{Err: fmt.Errorf("expected %d receivers, got %d after serialization", len(conf.Receivers), len(loaded.Receivers))}
+	}
+	if len(loaded.Route.Routes) != len(conf.Route.Routes) {
+		return &ValidationError{Err: fmt.Errorf("expected %d routes, got %d after serialization", len(conf.Route.Routes), len(loaded.Route.Routes))}
+	}
+	if br := findBotRoute(conf); br != nil {
+		if lbr := findBotRoute(loaded); lbr == nil || len(lbr.Routes) != len(br.Routes) {
+			return &ValidationError{Err: fmt.Errorf("bot routes are changed after serialization")}
+		}
+	}
+
+	return nil
+}
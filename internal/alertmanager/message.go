@@ -7,18 +7,46 @@ import (
 	"github.com/prometheus/common/model"
 )
 
-func (a *Alertmanager) GetMessageText(alerts []*model.Alert) (string, error) {
+func (a *Alertmanager) GetMessageText(receiver string, alerts []*model.Alert) (string, error) {
+	tmpl, err := a.template()
+	if err != nil {
+		return "", err
+	}
+
+	return a.execute(tmpl, tmpl.Data(receiver, nil, alerts...))
+}
+
+// GetWebhookMessageText renders whole webhook message, so templates
+// could use group level fields, like .Status or .GroupLabels
+func (a *Alertmanager) GetWebhookMessageText(wh *Webhook) (string, error) {
+	tmpl, err := a.template()
+	if err != nil {
+		return "", err
+	}
+
+	data := wh.Data
+	if data.ExternalURL == "" {
+		data.ExternalURL = tmpl.ExternalURL.String()
+	}
+
+	return a.execute(tmpl, &data)
+}
+
+func (a *Alertmanager) template() (*Template, error) {
 	tmpl, err := FromGlobs(a.tp)
 	if err != nil {
-		return "", fmt.Errorf("failed to read template files: %s", err)
+		return nil, fmt.Errorf("failed to read template files: %s", err)
 	}
 
 	tmpl.ExternalURL, err = url.Parse(a.url)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse alertmanager url: %s", err)
+		return nil, fmt.Errorf("failed to parse alertmanager url: %s", err)
 	}
 
-	data := tmpl.Data(nil, alerts...)
+	return tmpl, nil
+}
+
+func (a *Alertmanager) execute(tmpl *Template, data *Data) (string, error) {
 	out, err := tmpl.ExecuteHTMLString(`{{ template "telegram.default" . }}`, data)
 	if err != nil {
 		return "", fmt.Errorf("failed to apply template: %s", err)
@@ -0,0 +1,176 @@
+package alertmanager
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+)
+
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual bool   `json:"isEqual"`
+}
+
+// String returns matcher in alertmanager matchers syntax
+func (m Matcher) String() string {
+	op := "="
+	switch {
+	case m.IsRegex && m.IsEqual:
+		op = "=~"
+	case m.IsRegex:
+		op = "!~"
+	case !m.IsEqual:
+		op = "!="
+	}
+
+	return fmt.Sprintf("%s%s%q", m.Name, op, m.Value)
+}
+
+type Silence struct {
+	ID        string         `json:"id,omitempty"`
+	Matchers  []Matcher      `json:"matchers"`
+	StartsAt  time.Time      `json:"startsAt"`
+	EndsAt    time.Time      `json:"endsAt"`
+	CreatedBy string         `json:"createdBy"`
+	Comment   string         `json:"comment"`
+	Status    *SilenceStatus `json:"status,omitempty"`
+}
+
+type SilenceStatus struct {
+	State string `json:"state"`
+}
+
+// MatchersString returns silence matchers in alertmanager matchers syntax
+func (s *Silence) MatchersString() string {
+	ms := make([]string, 0, len(s.Matchers))
+	for _, m := range s.Matchers {
+		ms = append(ms, m.String())
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(ms, ", "))
+}
+
+// LabelMatchers returns silence matchers converted to alertmanager labels matchers
+func (s *Silence) LabelMatchers() (labels.Matchers, error) {
+	out := make(labels.Matchers, 0, len(s.Matchers))
+	for _, m := range s.Matchers {
+		t := labels.MatchEqual
+		switch {
+		case m.IsRegex && m.IsEqual:
+			t = labels.MatchRegexp
+		case m.IsRegex:
+			t = labels.MatchNotRegexp
+		case !m.IsEqual:
+			t = labels.MatchNotEqual
+		}
+
+		lm, err := labels.NewMatcher(t, m.Name, m.Value)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, lm)
+	}
+
+	return out, nil
+}
+
+// IsActual returns true for active and pending silences
+func (s *Silence) IsActual() bool {
+	return s.Status != nil && (s.Status.State == "active" || s.Status.State == "pending")
+}
+
+type silenceResponse struct {
+	SilenceID string `json:"silenceID"`
+}
+
+// NewSilence returns silence object, which starts now and lasts given duration
+func NewSilence(matchers []*labels.Matcher, d time.Duration, createdBy, comment string) *Silence {
+	now := time.Now()
+	s := &Silence{
+		Matchers:  make([]Matcher, 0, len(matchers)),
+		StartsAt:  now,
+		EndsAt:    now.Add(d),
+		CreatedBy: createdBy,
+		Comment:   comment,
+	}
+
+	for _, m := range matchers {
+		s.Matchers = append(s.Matchers, Matcher{
+			Name:    m.Name,
+			Value:   m.Value,
+			IsRegex: m.Type == labels.MatchRegexp || m.Type == labels.MatchNotRegexp,
+			IsEqual: m.Type == labels.MatchEqual || m.Type == labels.MatchRegexp,
+		})
+	}
+
+	return s
+}
+
+// MatchersFromLabels returns equality matchers for every label in given set
+func MatchersFromLabels(ls model.LabelSet) ([]*labels.Matcher, error) {
+	if err := ls.Validate(); err != nil {
+		return nil, err
+	}
+
+	out := make([]*labels.Matcher, 0, len(ls))
+	for k, v := range ls {
+		m, err := labels.NewMatcher(labels.MatchEqual, string(k), string(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid label %s: %s", k, err)
+		}
+		out = append(out, m)
+	}
+
+	return out, nil
+}
+
+// CreateSilence creates given silence and returns its id.
+func (a *Alertmanager) CreateSilence(s *Silence) (string, error) {
+	var sr silenceResponse
+	if err := a.do(http.MethodPost, "/silences", nil, s, &sr); err != nil {
+		return "", err
+	}
+
+	return sr.SilenceID, nil
+}
+
+// ListSilences returns active and pending silences.
+func (a *Alertmanager) ListSilences() ([]*Silence, error) {
+	var silences []*Silence
+	if err := a.do(http.MethodGet, "/silences", nil, nil, &silences); err != nil {
+		return nil, err
+	}
+
+	out := make([]*Silence, 0, len(silences))
+	for _, s := range silences {
+		if s.IsActual() {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].EndsAt.Before(out[j].EndsAt) })
+
+	return out, nil
+}
+
+// GetSilence returns silence with given id.
+func (a *Alertmanager) GetSilence(id string) (*Silence, error) {
+	var s Silence
+	if err := a.do(http.MethodGet, "/silence/"+url.PathEscape(id), nil, nil, &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// ExpireSilence expires silence with given id.
+func (a *Alertmanager) ExpireSilence(id string) error {
+	return a.do(http.MethodDelete, "/silence/"+url.PathEscape(id), nil, nil, nil)
+}
@@ -248,6 +248,10 @@ type Data struct {
 	CommonAnnotations KV `json:"commonAnnotations"`
 
 	ExternalURL string `json:"externalURL"`
+
+	// following fields are filled for webhook messages only
+	GroupKey        string `json:"groupKey"`
+	TruncatedAlerts uint64 `json:"truncatedAlerts"`
 }
 
 // Alert holds one alert for notification templates.
@@ -287,10 +291,10 @@ func (as Alerts) Resolved() []Alert {
 }
 
 // Data assembles data for template expansion.
-func (t *Template) Data(groupLabels model.LabelSet, alerts ...*model.Alert) *Data {
+func (t *Template) Data(recv string, groupLabels model.LabelSet, alerts ...*model.Alert) *Data {
 	data := &Data{
-		// Receiver:          regexp.QuoteMeta(recv),
-		// Status:            string(types.Alerts(alerts...).Status()),
+		Receiver:          regexp.QuoteMeta(recv),
+		Status:            string(model.AlertResolved),
 		Alerts:            make(Alerts, 0, len(alerts)),
 		GroupLabels:       KV{},
 		CommonLabels:      KV{},
@@ -318,6 +322,10 @@ func (t *Template) Data(groupLabels model.LabelSet, alerts ...*model.Alert) *Dat
 			alert.Annotations[string(k)] = string(v)
 		}
 		data.Alerts = append(data.Alerts, alert)
+
+		if a.Status() == model.AlertFiring {
+			data.Status = string(model.AlertFiring)
+		}
 	}
 
 	for k, v := range groupLabels {
@@ -1,23 +1,40 @@
 package app
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 
 	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager"
+	amconfig "github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
+	"github.com/sputnik-systems/alertmanager_bot/internal/audit"
 	"github.com/sputnik-systems/alertmanager_bot/internal/bot"
+	"github.com/sputnik-systems/alertmanager_bot/internal/policy"
+	"github.com/sputnik-systems/alertmanager_bot/internal/registration"
+)
+
+const (
+	// cookie binding oidc authorization state with browser, which started registration
+	oidcStateCookie = "alertmanager_bot_oidc_state"
 )
 
 var (
 	tb *bot.Bot
+	ri *registration.Issuer
+	oc *registration.OIDC
+	al *audit.Log
 )
 
 func botPreRunE(cmd *cobra.Command, args []string) error {
@@ -32,16 +49,65 @@ func botPreRunE(cmd *cobra.Command, args []string) error {
 	au := viper.GetString("alertmanager.url")
 	wu := viper.GetString("bot.webhook-url")
 	tp := viper.GetString("bot.templates-path")
-	ns := viper.GetString("kube.namespace")
-	acd := viper.GetString("alertmanager.dest-secret-name")
-	acm := viper.GetString("alertmanager.manual-secret-name")
+	mp := viper.GetString("bot.messages-store-path")
 
-	kc, err := client.New(config.GetConfigOrDie(), client.Options{})
+	kc, err := newKubeClient()
 	if err != nil {
 		return fmt.Errorf("kube client initialization failed: %s", err)
 	}
 
-	tb, err = bot.New(token, au, wu, tp, ns, acd, acm, kc)
+	dest, manual, err := newConfigStorages(kc)
+	if err != nil {
+		return fmt.Errorf("alertmanager config storage initialization failed: %s", err)
+	}
+
+	ri, err = registration.New(viper.GetString("bot.registration-secret"), viper.GetDuration("bot.registration-ttl"), viper.GetString("bot.registration-store-path"))
+	if err != nil {
+		return fmt.Errorf("registration tokens issuer initialization failed: %s", err)
+	}
+
+	if viper.GetString("oidc.issuer-url") != "" {
+		oc, err = registration.NewOIDC(context.Background(), registration.OIDCConfig{
+			IssuerURL:      viper.GetString("oidc.issuer-url"),
+			ClientID:       viper.GetString("oidc.client-id"),
+			ClientSecret:   viper.GetString("oidc.client-secret"),
+			RedirectURL:    fmt.Sprintf("%s/auth/callback", viper.GetString("bot.public-url")),
+			Scopes:         viper.GetStringSlice("oidc.scopes"),
+			GroupsClaim:    viper.GetString("oidc.groups-claim"),
+			AllowedDomains: viper.GetStringSlice("oidc.allowed-domains"),
+			AllowedGroups:  viper.GetStringSlice("oidc.allowed-groups"),
+		})
+		if err != nil {
+			return fmt.Errorf("oidc initialization failed: %s", err)
+		}
+	}
+
+	ids, err := registration.NewIdentities(viper.GetString("oidc.identities-store-path"))
+	if err != nil {
+		return fmt.Errorf("identities store initialization failed: %s", err)
+	}
+
+	pl, err := policy.Load(viper.GetString("bot.policy-path"))
+	if err != nil {
+		return fmt.Errorf("access policy initialization failed: %s", err)
+	}
+
+	al, err = audit.New(viper.GetString("bot.audit-log-path"), viper.GetInt("bot.audit-log-size"))
+	if err != nil {
+		return fmt.Errorf("audit log initialization failed: %s", err)
+	}
+
+	var admins []int64
+	for _, id := range viper.GetIntSlice("bot.admins") {
+		admins = append(admins, int64(id))
+	}
+
+	mmp := viper.GetInt("bot.max-message-parts")
+	qs := viper.GetInt("bot.send-queue-size")
+	rl := viper.GetFloat64("bot.rate-limit")
+	crl := viper.GetFloat64("bot.chat-rate-limit")
+
+	tb, err = bot.New(token, au, wu, tp, mp, dest, manual, kc, ri, ids, pl, al, admins, mmp, qs, rl, crl)
 	if err != nil {
 		return fmt.Errorf("bot initialization failed: %s", err)
 	}
@@ -49,6 +115,67 @@ func botPreRunE(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+// newKubeClient returns kube client, file config storage may be used
+// without kubernetes, so nil is returned if kube config isn't found
+func newKubeClient() (client.Client, error) {
+	kubeconfig, err := config.GetConfig()
+	if err != nil {
+		if viper.GetString("alertmanager.storage") == "file" {
+			log.Printf("kube config isn't found, alert rules discovery is disabled: %s", err)
+
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return client.New(kubeconfig, client.Options{})
+}
+
+// newConfigStorages returns destination and optional manual alertmanager config storages
+func newConfigStorages(kc client.Client) (amconfig.Storage, amconfig.Storage, error) {
+	ns := viper.GetString("kube.namespace")
+
+	var dest, manual amconfig.Storage
+	switch kind := viper.GetString("alertmanager.storage"); kind {
+	case "secret":
+		if viper.GetString("alertmanager.dest-secret-name") == "" {
+			return nil, nil, fmt.Errorf("alertmanager.dest-secret-name flag is required")
+		}
+
+		dest = amconfig.NewSecretStorage(ns, viper.GetString("alertmanager.dest-secret-name"), kc)
+		if name := viper.GetString("alertmanager.manual-secret-name"); name != "" {
+			manual = amconfig.NewSecretStorage(ns, name, kc)
+		}
+	case "configmap":
+		if viper.GetString("alertmanager.dest-configmap-name") == "" {
+			return nil, nil, fmt.Errorf("alertmanager.dest-configmap-name flag is required")
+		}
+
+		dest = amconfig.NewConfigMapStorage(ns, viper.GetString("alertmanager.dest-configmap-name"), kc)
+		if name := viper.GetString("alertmanager.manual-configmap-name"); name != "" {
+			manual = amconfig.NewConfigMapStorage(ns, name, kc)
+		}
+	case "file":
+		if viper.GetString("alertmanager.dest-path") == "" {
+			return nil, nil, fmt.Errorf("alertmanager.dest-path flag is required")
+		}
+
+		dest = amconfig.NewFileStorage(viper.GetString("alertmanager.dest-path"))
+		if path := viper.GetString("alertmanager.manual-path"); path != "" {
+			manual = amconfig.NewFileStorage(path)
+		}
+	case "alertmanagerconfig":
+		dest = amconfig.NewAlertmanagerConfigStorage(ns, viper.GetString("alertmanager.resource-prefix"), kc)
+	case "vmalertmanagerconfig":
+		dest = amconfig.NewVMAlertmanagerConfigStorage(ns, viper.GetString("alertmanager.resource-prefix"), kc)
+	default:
+		return nil, nil, fmt.Errorf("unknown storage type \"%s\"", kind)
+	}
+
+	return dest, manual, nil
+}
+
 func botRunE(cmd *cobra.Command, args []string) error {
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -57,6 +184,8 @@ func botRunE(cmd *cobra.Command, args []string) error {
 		http.HandleFunc("/health", healthChekHandler)
 		http.HandleFunc("/webhook", webhookHandler)
 		http.HandleFunc("/auth", registrationHandler)
+		http.HandleFunc("/auth/callback", oidcCallbackHandler)
+		http.HandleFunc("/audit", auditHandler)
 
 		if err := http.ListenAndServe(":8000", nil); err != nil {
 			log.Printf("web server execution failed: %s", err)
@@ -65,6 +194,21 @@ func botRunE(cmd *cobra.Command, args []string) error {
 		}
 	}()
 
+	// metrics are served by separate listener, which isn't exposed publicly
+	// like registration and webhook endpoints
+	if addr := viper.GetString("metrics.listen-address"); addr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", promhttp.Handler())
+
+			if err := http.ListenAndServe(addr, mux); err != nil {
+				log.Printf("metrics server execution failed: %s", err)
+
+				wg.Done()
+			}
+		}()
+	}
+
 	go func() {
 		tb.Start()
 
@@ -81,41 +225,208 @@ func botRunE(cmd *cobra.Command, args []string) error {
 func healthChekHandler(w http.ResponseWriter, r *http.Request) {}
 
 func webhookHandler(w http.ResponseWriter, r *http.Request) {
-	alerts, receiver, err := alertmanager.GetWebhookData(r)
+	wh, err := alertmanager.GetWebhookData(r)
 	if err != nil {
 		log.Printf("failed to get webhook: %s", err)
+		writeError(w, http.StatusBadRequest, "Webhook data is incorrect")
+
+		return
 	}
 
-	if err = tb.ProcessWebhook(alerts, receiver); err != nil {
+	if err = tb.ProcessWebhook(wh); err == bot.ErrQueueFull {
+		// alertmanager repeats failed notifications later
+		log.Printf("failed to process webhook: %s", err)
+		writeError(w, http.StatusServiceUnavailable, "Too many notifications are queued")
+	} else if err != nil {
 		log.Printf("failed to process webhook: %s", err)
 	}
 }
 
-// simple registration processor
+// registration processor, it registers receiver immediately with simple auth
+// or redirects to identity provider, if oidc is enabled
 func registrationHandler(w http.ResponseWriter, r *http.Request) {
-	if viper.GetString("oidc.issuer-url") != "" {
-		w.WriteHeader(http.StatusForbidden)
-		if _, err := w.Write([]byte("Simple registration is not supported with another auth types")); err != nil {
-			log.Printf("failed to write response body: %s", err)
+	receiver := r.URL.Query().Get("receiver")
+	id, err := strconv.ParseInt(receiver, 10, 64)
+	if err != nil {
+		log.Printf("failed to parse receiver id \"%s\": %s", receiver, err)
+		writeError(w, http.StatusBadRequest, "Receiver id is incorrect")
+
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if err := ri.Verify(token, id); err != nil {
+		log.Printf("registration of receiver %d rejected: %s", id, err)
+
+		switch err {
+		case registration.ErrExpiredToken, registration.ErrUsedToken:
+			writeError(w, http.StatusGone, "Registration link is expired or already used, request new one with /start command")
+		default:
+			writeError(w, http.StatusForbidden, "Registration link is invalid")
 		}
 
 		return
 	}
 
-	receiver := r.URL.Query().Get("receiver")
-	id, err := strconv.ParseInt(receiver, 10, 64)
-	if err != nil {
-		log.Printf("failed to parse receiver id \"%s\": %s", receiver, err)
+	if oc != nil {
+		u, state, err := oc.AuthCodeURL(id, token)
+		if err != nil {
+			log.Printf("failed to make oidc auth url: %s", err)
+			writeError(w, http.StatusInternalServerError, "Registration failed")
+
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    state,
+			Path:     "/auth/callback",
+			MaxAge:   int(registration.StateTTL.Seconds()),
+			Secure:   r.TLS != nil || strings.HasPrefix(viper.GetString("bot.public-url"), "https://"),
+			HttpOnly: true,
+			// cookie is sent on redirect from identity provider
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, u, http.StatusFound)
 
 		return
 	}
 
-	if err := tb.RegisterReceiver(id); err != nil {
+	if err := tb.RegisterReceiver(id, nil); err != nil {
 		log.Printf("failed to register receiver %d: %s", id, err)
+		writeError(w, http.StatusInternalServerError, "Registration failed")
+
+		return
 	}
+	useRegistrationToken(token, id)
 
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write([]byte("Success")); err != nil {
 		log.Printf("failed to write response body: %s", err)
 	}
 }
+
+// oidc authorization code flow callback processor
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if oc == nil {
+		writeError(w, http.StatusNotFound, "OIDC registration is not enabled")
+
+		return
+	}
+
+	// state is accepted only from browser, which started authorization,
+	// so victim can't be logged in with authorization of another user
+	state := r.URL.Query().Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		log.Printf("oidc callback rejected: authorization state doesn't match cookie")
+		writeError(w, http.StatusForbidden, "Authorization failed, open registration link in the same browser")
+
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/auth/callback", MaxAge: -1})
+
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		log.Printf("identity provider returned error: %s: %s", e, query.Get("error_description"))
+		writeError(w, http.StatusForbidden, "Authorization failed")
+
+		return
+	}
+
+	id, token, identity, err := oc.Exchange(r.Context(), state, query.Get("code"))
+	switch err {
+	case nil:
+	case registration.ErrUnknownState:
+		writeError(w, http.StatusGone, "Authorization is expired, request new registration link with /start command")
+
+		return
+	case registration.ErrForbidden:
+		log.Printf("identity %s (%s) is not allowed to register receiver %d", identity.Subject, identity.Email, id)
+		writeError(w, http.StatusForbidden, "Your identity is not allowed to register")
+
+		return
+	default:
+		log.Printf("failed to finish oidc flow: %s", err)
+		writeError(w, http.StatusForbidden, "Authorization failed")
+
+		return
+	}
+
+	// registration link may be used by another authorization meanwhile
+	if err := ri.Verify(token, id); err != nil {
+		log.Printf("registration of receiver %d rejected: %s", id, err)
+		writeError(w, http.StatusGone, "Registration link is expired or already used, request new one with /start command")
+
+		return
+	}
+
+	if err := tb.RegisterReceiver(id, identity); err != nil {
+		log.Printf("failed to register receiver %d: %s", id, err)
+		writeError(w, http.StatusInternalServerError, "Registration failed")
+
+		return
+	}
+	useRegistrationToken(token, id)
+
+	log.Printf("receiver %d registered by %s (%s)", id, identity.Subject, identity.Email)
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("Success")); err != nil {
+		log.Printf("failed to write response body: %s", err)
+	}
+}
+
+// audit log processor, it is enabled only when access token is specified
+func auditHandler(w http.ResponseWriter, r *http.Request) {
+	token := viper.GetString("bot.audit-token")
+	if token == "" {
+		writeError(w, http.StatusNotFound, "Audit log endpoint is not enabled")
+
+		return
+	}
+
+	auth := r.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+
+		return
+	}
+
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil {
+			writeError(w, http.StatusBadRequest, "Limit is incorrect")
+
+			return
+		}
+	}
+
+	data, err := json.Marshal(al.List(limit))
+	if err != nil {
+		log.Printf("failed to marshal audit records: %s", err)
+		writeError(w, http.StatusInternalServerError, "Failed to get audit records")
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(data); err != nil {
+		log.Printf("failed to write response body: %s", err)
+	}
+}
+
+// useRegistrationToken marks registration token as used after successful registration
+func useRegistrationToken(token string, receiver int64) {
+	if err := ri.Use(token, receiver); err != nil {
+		log.Printf("failed to mark registration token of receiver %d as used: %s", receiver, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, text string) {
+	w.WriteHeader(code)
+	if _, err := w.Write([]byte(text)); err != nil {
+		log.Printf("failed to write response body: %s", err)
+	}
+}
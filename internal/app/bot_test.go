@@ -0,0 +1,53 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/registration"
+)
+
+func TestOIDCCallbackStateCookie(t *testing.T) {
+	oc = &registration.OIDC{}
+	defer func() { oc = nil }()
+
+	tests := []struct {
+		name   string
+		cookie string
+		code   int
+	}{
+		{"missing cookie", "", http.StatusForbidden},
+		{"cookie of another authorization", "other", http.StatusForbidden},
+		// state matches cookie, but it is unknown for bot
+		{"matching cookie", "state", http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/auth/callback?state=state&code=code", nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+
+			oidcCallbackHandler(w, r)
+
+			if w.Code != tt.code {
+				t.Errorf("expected status %d, got %d: %s", tt.code, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhookHandlerBadRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader("not a webhook"))
+	w := httptest.NewRecorder()
+
+	webhookHandler(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -29,16 +30,44 @@ func Execute() error {
 
 	botRunCmd.PersistentFlags().String("kube.namespace", "default", "specify current k8s namespace")
 	botRunCmd.PersistentFlags().String("alertmanager.url", "http://localhost:9093", "alertmanager endpoint url")
-	botRunCmd.PersistentFlags().String("alertmanager.dest-secret-name", "", "this secret will be used by alertmanager")
+	botRunCmd.PersistentFlags().String("alertmanager.storage", "secret", "alertmanager config storage type, one of secret, configmap, file, alertmanagerconfig or vmalertmanagerconfig")
+	botRunCmd.PersistentFlags().String("alertmanager.dest-secret-name", "", "this secret will be used by alertmanager (required with secret storage)")
 	botRunCmd.PersistentFlags().String("alertmanager.manual-secret-name", "", "this secret should contain predefined custom user config, and it will be merged with alertmanager.dynamic-secret-name")
+	botRunCmd.PersistentFlags().String("alertmanager.dest-configmap-name", "", "this configmap will be used by alertmanager (required with configmap storage)")
+	botRunCmd.PersistentFlags().String("alertmanager.manual-configmap-name", "", "this configmap should contain predefined custom user config, and it will be merged with alertmanager.dest-configmap-name")
+	botRunCmd.PersistentFlags().String("alertmanager.dest-path", "", "this file will be used by alertmanager (required with file storage)")
+	botRunCmd.PersistentFlags().String("alertmanager.manual-path", "", "this file should contain predefined custom user config, and it will be merged with alertmanager.dest-path")
+	botRunCmd.PersistentFlags().String("alertmanager.resource-prefix", "alertmanager-bot", "name prefix of AlertmanagerConfig or VMAlertmanagerConfig resources created for receivers")
 	botRunCmd.PersistentFlags().String("bot.token", "", "bot token string (required)")
 	botRunCmd.PersistentFlags().String("bot.templates-path", "templates/default.tmpl", "bot message templates path")
 	botRunCmd.PersistentFlags().String("bot.webhook-url", "http://bot:8000/webhook", "bot webhook url")
 	botRunCmd.PersistentFlags().String("bot.public-url", "http://localhost:8000", "bot webserver public url")
+	botRunCmd.PersistentFlags().String("bot.registration-secret", "", "secret for registration links signing, random one is generated if empty, BOT_REGISTRATION_SECRET environment variable may be used instead")
+	botRunCmd.PersistentFlags().Duration("bot.registration-ttl", 15*time.Minute, "registration links lifetime")
+	botRunCmd.PersistentFlags().String("bot.registration-store-path", "", "file for storing used registration links, they are kept in memory only if empty")
+	botRunCmd.PersistentFlags().String("bot.messages-store-path", "", "file for storing sent alert messages ids, messages are kept in memory only if empty")
+	botRunCmd.PersistentFlags().Int("bot.send-queue-size", 1000, "maximum number of notifications waiting for delivery, alertmanager gets 503 response when queue is full")
+	botRunCmd.PersistentFlags().Float64("bot.rate-limit", 30, "maximum number of messages sent per second to all chats")
+	botRunCmd.PersistentFlags().Float64("bot.chat-rate-limit", 20, "maximum number of messages sent per minute to single chat")
+	botRunCmd.PersistentFlags().Int("bot.max-message-parts", 5, "maximum number of messages too long notification is split into, longer notifications are sent as html document, 0 means no limit")
+
+	botRunCmd.PersistentFlags().String("bot.audit-log-path", "", "file for storing audit log of subscription changes, log is kept in memory only if empty")
+	botRunCmd.PersistentFlags().Int("bot.audit-log-size", 1000, "number of last audit log records to keep")
+	botRunCmd.PersistentFlags().String("bot.audit-token", "", "bearer token for /audit http endpoint, endpoint is disabled if empty")
+	botRunCmd.PersistentFlags().IntSlice("bot.admins", []int{}, "telegram user ids of bot administrators, allowed to use /audit command")
+	botRunCmd.PersistentFlags().String("bot.policy-path", "", "access policy file, which maps identities to allowed alerts, all alerts are allowed if empty")
+	botRunCmd.PersistentFlags().String("oidc.issuer-url", "", "oidc issuer url, enables registration over oidc authorization code flow")
+	botRunCmd.PersistentFlags().String("oidc.client-id", "", "oidc client id")
+	botRunCmd.PersistentFlags().String("oidc.client-secret", "", "oidc client secret, OIDC_CLIENT_SECRET environment variable may be used instead")
+	botRunCmd.PersistentFlags().StringSlice("oidc.scopes", []string{"openid", "email", "profile"}, "oidc scopes")
+	botRunCmd.PersistentFlags().String("oidc.groups-claim", "groups", "id token claim with user groups")
+	botRunCmd.PersistentFlags().StringSlice("oidc.allowed-domains", []string{}, "email domains allowed to register, any identity is allowed if empty with oidc.allowed-groups")
+	botRunCmd.PersistentFlags().StringSlice("oidc.allowed-groups", []string{}, "groups allowed to register, any identity is allowed if empty with oidc.allowed-domains")
+	botRunCmd.PersistentFlags().String("oidc.identities-store-path", "", "file for storing identities bound with chats, identities are kept in memory only if empty")
+	botRunCmd.PersistentFlags().String("metrics.listen-address", ":8080", "listen address of /metrics endpoint, metrics are disabled if empty")
 
 	persistentRequiredFlags := []string{
 		"bot.token",
-		"alertmanager.dest-secret-name",
 	}
 	for _, value := range persistentRequiredFlags {
 		err = botRunCmd.MarkPersistentFlagRequired(value)
@@ -50,12 +79,40 @@ func Execute() error {
 	bindFlags := []string{
 		"kube.namespace",
 		"alertmanager.url",
+		"alertmanager.storage",
 		"alertmanager.dest-secret-name",
 		"alertmanager.manual-secret-name",
+		"alertmanager.dest-configmap-name",
+		"alertmanager.manual-configmap-name",
+		"alertmanager.dest-path",
+		"alertmanager.manual-path",
+		"alertmanager.resource-prefix",
 		"bot.token",
 		"bot.templates-path",
 		"bot.webhook-url",
 		"bot.public-url",
+		"bot.registration-secret",
+		"bot.registration-ttl",
+		"bot.registration-store-path",
+		"bot.messages-store-path",
+		"bot.max-message-parts",
+		"bot.send-queue-size",
+		"bot.rate-limit",
+		"bot.chat-rate-limit",
+		"bot.audit-log-path",
+		"bot.audit-log-size",
+		"bot.audit-token",
+		"bot.admins",
+		"bot.policy-path",
+		"oidc.issuer-url",
+		"oidc.client-id",
+		"oidc.client-secret",
+		"oidc.scopes",
+		"oidc.groups-claim",
+		"oidc.allowed-domains",
+		"oidc.allowed-groups",
+		"oidc.identities-store-path",
+		"metrics.listen-address",
 	}
 	for _, value := range bindFlags {
 		err = viper.BindPFlag(value, botRunCmd.PersistentFlags().Lookup(value))
@@ -64,6 +121,18 @@ func Execute() error {
 		}
 	}
 
+	// secrets may be passed by environment, so they aren't exposed in process arguments
+	bindEnvs := map[string]string{
+		"bot.registration-secret": "BOT_REGISTRATION_SECRET",
+		"oidc.client-secret":      "OIDC_CLIENT_SECRET",
+	}
+	for key, env := range bindEnvs {
+		err = viper.BindEnv(key, env)
+		if err != nil {
+			return fmt.Errorf("failed to bind environment variable \"%s\": %s", env, err)
+		}
+	}
+
 	rootCmd.AddCommand(botRunCmd)
 
 	err = rootCmd.Execute()
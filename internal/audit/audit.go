@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/storage"
+)
+
+// Record describes single change of alertmanager config made by bot
+type Record struct {
+	Time     time.Time `json:"time"`
+	UserID   int64     `json:"user_id,omitempty"`
+	Username string    `json:"username,omitempty"`
+	Chat     int64     `json:"chat"`
+	Action   string    `json:"action"`
+	Matcher  string    `json:"matcher,omitempty"`
+	Before   string    `json:"before,omitempty"`
+	After    string    `json:"after,omitempty"`
+}
+
+// Log keeps last config changes
+type Log struct {
+	path    string
+	size    int
+	records []Record
+	mux     sync.Mutex
+}
+
+// New loads audit log from given file, empty path means that
+// records will be kept in memory only. Only last size records are kept.
+func New(path string, size int) (*Log, error) {
+	l := &Log{
+		path: path,
+		size: size,
+	}
+
+	if path == "" {
+		return l, nil
+	}
+
+	if err := storage.ReadJSON(path, &l.records); err != nil {
+		return nil, fmt.Errorf("failed to load audit log: %s", err)
+	}
+
+	return l, nil
+}
+
+// Add appends record to log
+func (l *Log) Add(r Record) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	log.Printf(
+		"audit: user %d (%s) in chat %d: %s %s, config %s -> %s",
+		r.UserID, r.Username, r.Chat, r.Action, r.Matcher, r.Before, r.After,
+	)
+
+	l.records = append(l.records, r)
+	if l.size > 0 && len(l.records) > l.size {
+		l.records = l.records[len(l.records)-l.size:]
+	}
+
+	return l.save()
+}
+
+// List returns last n records starting from the newest one, all records are returned if n isn't positive
+func (l *Log) List(n int) []Record {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if n <= 0 || n > len(l.records) {
+		n = len(l.records)
+	}
+
+	out := make([]Record, 0, n)
+	for i := len(l.records) - 1; i >= len(l.records)-n; i-- {
+		out = append(out, l.records[i])
+	}
+
+	return out
+}
+
+// save writes records to log file, should be called under lock
+func (l *Log) save() error {
+	if l.path == "" {
+		return nil
+	}
+
+	if err := storage.WriteJSON(l.path, l.records); err != nil {
+		return fmt.Errorf("failed to save audit log: %s", err)
+	}
+
+	return nil
+}
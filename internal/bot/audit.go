@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	"gopkg.in/tucnak/telebot.v3"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
+	"github.com/sputnik-systems/alertmanager_bot/internal/audit"
+)
+
+const (
+	// number of audit records shown by /audit command
+	AuditRecordsLimit = 20
+
+	AdminOnlyText = "This command is allowed for bot administrators only."
+)
+
+var (
+	adminCmds = []telebot.Command{
+		{Text: "/audit", Description: "Show last subscription changes"},
+	}
+)
+
+func (b *Bot) isAdmin(u *telebot.User) bool {
+	return u != nil && b.admins[u.ID]
+}
+
+// setAdminCommands shows admin commands in private chats with bot administrators only
+func (b *Bot) setAdminCommands() {
+	data, _ := json.Marshal(append(append([]telebot.Command{}, cmds...), adminCmds...))
+	for id := range b.admins {
+		scope, _ := json.Marshal(map[string]interface{}{"type": "chat", "chat_id": id})
+		params := map[string]string{
+			"commands": string(data),
+			"scope":    string(scope),
+		}
+
+		// administrator may have no private chat with bot yet
+		if _, err := b.b.Raw("setMyCommands", params); err != nil {
+			log.Printf("failed to set telegram bot commands for administrator %d: %s", id, err)
+		}
+	}
+}
+
+// record saves config change made by user into audit log,
+// nothing is saved if config isn't changed
+func (b *Bot) record(u *telebot.User, chat int64, action, matcher string, change *config.Change) {
+	if change == nil {
+		return
+	}
+
+	r := audit.Record{
+		Chat:    chat,
+		Action:  action,
+		Matcher: matcher,
+		Before:  change.Before,
+		After:   change.After,
+	}
+	if u != nil {
+		r.UserID = u.ID
+		r.Username = getUserName(u)
+	}
+
+	if err := b.audit.Add(r); err != nil {
+		log.Printf("failed to write audit record: %s", err)
+	}
+}
+
+func (b *Bot) handleAuditCommand(m telebot.Context) error {
+	if !b.isAdmin(m.Sender()) {
+		return m.Send(AdminOnlyText)
+	}
+
+	records := b.audit.List(AuditRecordsLimit)
+	if len(records) == 0 {
+		return m.Send("Audit log is empty")
+	}
+
+	lines := make([]string, 0, len(records))
+	for _, r := range records {
+		user := r.Username
+		if user == "" {
+			user = "unknown"
+		}
+
+		line := fmt.Sprintf(
+			"<code>%s</code> %s in %d: <b>%s</b>",
+			r.Time.Format("02 Jan 15:04:05"), html.EscapeString(user), r.Chat, r.Action,
+		)
+		if r.Matcher != "" {
+			line += fmt.Sprintf(" <code>%s</code>", html.EscapeString(r.Matcher))
+		}
+		line += fmt.Sprintf("\nconfig %s → %s", r.Before, r.After)
+
+		lines = append(lines, line)
+	}
+
+	_, err := b.send(m.Chat().ID, strings.Join(lines, "\n\n"), &telebot.SendOptions{})
+
+	return err
+}
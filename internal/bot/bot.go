@@ -3,12 +3,15 @@ package bot
 import (
 	"errors"
 	"fmt"
+	"html"
 	"log"
+	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/prometheus/alertmanager/pkg/labels"
 	"github.com/prometheus/common/model"
 	"github.com/vcraescu/go-paginator/v2"
 	"github.com/vcraescu/go-paginator/v2/adapter"
@@ -16,13 +19,20 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager"
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
+	"github.com/sputnik-systems/alertmanager_bot/internal/audit"
 	"github.com/sputnik-systems/alertmanager_bot/internal/monitoring/rules"
 	prom "github.com/sputnik-systems/alertmanager_bot/internal/monitoring/rules/prometheus"
 	vm "github.com/sputnik-systems/alertmanager_bot/internal/monitoring/rules/victoriametrics"
+	"github.com/sputnik-systems/alertmanager_bot/internal/policy"
+	"github.com/sputnik-systems/alertmanager_bot/internal/registration"
 )
 
 const (
 	CallbackLimit = 64
+
+	MatchersUsageText = `Usage: <code>/subscribematchers &lt;matchers&gt;</code>
+Example: <code>/subscribematchers severity="critical", namespace=~"payments-.*"</code>`
 )
 
 var (
@@ -31,34 +41,63 @@ var (
 		{Text: "/stop", Description: "Disable any alerting"},
 		{Text: "/subscribe", Description: "Subscribe to some alert group"},
 		{Text: "/subscribeall", Description: "Subscribe to all alert groups"},
+		{Text: "/subscribealert", Description: "Subscribe to some alerts of alert group"},
+		{Text: "/subscribematchers", Description: "Subscribe to alerts by label matchers"},
 		{Text: "/unsubscribe", Description: "Revoke subscribtion"},
 		{Text: "/alerts", Description: "List active alerts"},
+		{Text: "/silence", Description: "Create alerts silence"},
+		{Text: "/silences", Description: "List active silences"},
+		{Text: "/settings", Description: "Configure notifications grouping and repeating"},
+		{Text: "/quiet", Description: "Set weekly quiet hours"},
 	}
 
 	RegistrationURL      = "http://example.org:8000/auth/simple"
-	AuthFlowTextTemplate = `First you have to go auth <a href="%s?receiver=%d">flow</a>.`
+	AuthFlowTextTemplate = `First you have to go auth <a href="%s?receiver=%d&amp;token=%s">flow</a>.`
+
+	ErrAuth      = errors.New("authorization required")
+	ErrNotFound  = errors.New("no one alert group found")
+	ErrForbidden = errors.New("alerts are not allowed by access policy")
 
-	ErrAuth     = errors.New("authorization required")
-	ErrNotFound = errors.New("no one alert group found")
+	ForbiddenText       = "These alerts are not allowed for you by access policy."
+	SubscribedToAllText = "You are already subscribed for all alert groups. Unsubscribe first."
 )
 
 type Bot struct {
-	b     *telebot.Bot
-	pages map[int64]*paginator.Paginator
-	mux   sync.Mutex
-	kc    client.Client
-	ac    *alertmanager.Alertmanager
+	b        *telebot.Bot
+	pages    map[int64]*paginator.Paginator
+	titles   map[int64]string
+	tokens   *callbackRegistry
+	silences *callbackRegistry
+	messages *messageStore
+	mux      sync.Mutex
+	kc       client.Client
+	ac       *alertmanager.Alertmanager
+	ri       *registration.Issuer
+	ids      *registration.Identities
+	policy   *policy.Policy
+	audit    *audit.Log
+	admins   map[int64]bool
+	maxParts int
+	queue    *sendQueue
+	limiter  *rateLimiter
 }
 
-func New(token, au, wu, tp, ns, acd, acm string, kc client.Client) (*Bot, error) {
-	a, err := alertmanager.New(au, wu, tp, ns, acd, acm, kc)
+func New(token, au, wu, tp, mp string, dest, manual config.Storage, kc client.Client, ri *registration.Issuer, ids *registration.Identities, pl *policy.Policy, al *audit.Log, admins []int64, maxParts, queueSize int, rateLimit, chatRateLimit float64) (*Bot, error) {
+	a, err := alertmanager.New(au, wu, tp, dest, manual)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize alertmanager client: %s", err)
 	}
-	if acm != "" {
-		if err := a.Config.Sync(); err != nil {
-			return nil, fmt.Errorf("failed to update alertmanager config: %s", err)
-		}
+	// sync merges manual config and migrates config of previous bot versions
+	if err := a.Config.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to update alertmanager config: %s", err)
+	}
+	if err := a.Reload(); err != nil {
+		log.Printf("failed to reload alertmanager after config sync: %s", err)
+	}
+
+	ms, err := newMessageStore(mp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize messages store: %s", err)
 	}
 
 	tb, err := telebot.NewBot(telebot.Settings{
@@ -71,24 +110,52 @@ func New(token, au, wu, tp, ns, acd, acm string, kc client.Client) (*Bot, error)
 	}
 
 	b := &Bot{
-		b:     tb,
-		pages: make(map[int64]*paginator.Paginator),
-		kc:    kc,
-		ac:    a,
+		b:        tb,
+		pages:    make(map[int64]*paginator.Paginator),
+		titles:   make(map[int64]string),
+		tokens:   newCallbackRegistry(CallbackRegistrySize, CallbackTokenTTL),
+		silences: newCallbackRegistry(CallbackRegistrySize, CallbackTokenTTL),
+		messages: ms,
+		kc:       kc,
+		ac:       a,
+		ri:       ri,
+		ids:      ids,
+		policy:   pl,
+		audit:    al,
+		admins:   make(map[int64]bool),
+		maxParts: maxParts,
+		queue:    newSendQueue(queueSize),
+		limiter:  newRateLimiter(rateLimit, chatRateLimit),
+	}
+	for _, id := range admins {
+		b.admins[id] = true
+	}
+	if err := b.restrictRoutes(); err != nil {
+		log.Printf("failed to apply access policy to existing routes: %s", err)
 	}
 
 	if err := tb.SetCommands(cmds); err != nil {
 		return nil, fmt.Errorf("failed to set telegram bot commands: %s", err)
 	}
+	b.setAdminCommands()
 
 	tb.Handle("/start", b.handleStartCommand)
 	tb.Handle("/stop", b.handleStopCommand)
 	tb.Handle("/subscribe", b.handleSubscribeCommand)
 	tb.Handle("/subscribeall", b.handleSubscribeAllCommand)
+	tb.Handle("/subscribealert", b.handleSubscribeAlertCommand)
+	tb.Handle("/subscribematchers", b.handleSubscribeMatchersCommand)
 	tb.Handle("/unsubscribe", b.handleUnsubscribeCommand)
 	tb.Handle("/alerts", b.handleAlertsCommand)
+	tb.Handle("/silence", b.handleSilenceCommand)
+	tb.Handle("/silences", b.handleSilencesCommand)
+	tb.Handle("/settings", b.handleSettingsCommand)
+	tb.Handle("/quiet", b.handleQuietCommand)
+	tb.Handle("/audit", b.handleAuditCommand)
 
 	tb.Handle(telebot.OnCallback, b.handleCallback)
+	tb.Handle(telebot.OnMigration, b.handleMigration)
+	tb.Handle(telebot.OnMyChatMember, b.handleMyChatMember)
 
 	return b, nil
 }
@@ -97,32 +164,115 @@ func (b *Bot) Start() {
 	b.b.Start()
 }
 
-func (b *Bot) ProcessWebhook(alerts []*model.Alert, receiver string) error {
-	text, err := b.ac.GetMessageText(alerts)
+// ProcessWebhook queues webhook notification for delivery,
+// ErrQueueFull is returned if there are too many queued notifications
+func (b *Bot) ProcessWebhook(wh *alertmanager.Webhook) error {
+	text, err := b.ac.GetWebhookMessageText(wh)
 	if err != nil {
 		return fmt.Errorf("failed generating text from alert list: %s", err)
 	}
-	text = truncateMessage(text)
 	if strings.ReplaceAll(text, "\n", "") == "" {
 		text = "no alerts"
 	}
 
-	id, err := strconv.ParseInt(receiver, 10, 64)
+	id, err := b.ac.Config.ParseReceiverName(wh.Receiver)
 	if err != nil {
-		return fmt.Errorf("failed converting receiver string to int64")
+		return fmt.Errorf("failed converting receiver string to int64: %s", err)
 	}
 
-	_, err = b.b.Send(telebot.ChatID(id), text, telebot.NoPreview)
+	return b.queue.Push(id, func() error {
+		return b.deliver(id, wh, text)
+	})
+}
 
-	return err
+// deliver sends webhook notification to chat
+func (b *Bot) deliver(id int64, wh *alertmanager.Webhook, text string) error {
+	opts := &telebot.SendOptions{
+		DisableWebPagePreview: true,
+		ReplyMarkup:           b.silenceMarkup(wh.ModelAlerts()),
+	}
+
+	prev, ok := b.messages.Get(id, wh.GroupKey)
+	if ok && wh.IsResolved() && len(text) <= MessageLimit {
+		// resolved group replaces original notification
+		_, err := b.call(id, func() (*telebot.Message, error) {
+			return b.b.Edit(prev, text, opts)
+		})
+		if err == nil {
+			return b.messages.Delete(id, wh.GroupKey)
+		} else {
+			log.Printf("failed to edit message %s in chat %d: %s", prev.MessageID, id, err)
+		}
+	}
+	if ok && !wh.IsResolved() {
+		// changed group notification is threaded with previous one
+		if msgID, err := strconv.Atoi(prev.MessageID); err == nil {
+			opts.ReplyTo = &telebot.Message{ID: msgID}
+			opts.AllowWithoutReply = true
+		}
+	}
+
+	msg, err := b.send(id, text, opts)
+	if to, ok := migratedTo(err); ok {
+		// migration update could be missed, so receiver is migrated on send failure too
+		if err := b.migrateReceiver(id, to); err != nil {
+			return err
+		}
+
+		id, opts.ReplyTo = to, nil
+		msg, err = b.send(id, text, opts)
+	}
+	if isPermanentError(err) {
+		// receiver is removed, so alertmanager stops notifying unreachable chat
+		if err := b.removeReceiver(nil, id, err.Error()); err != nil {
+			log.Printf("failed to remove unreachable receiver %d: %s", id, err)
+		}
+
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if wh.GroupKey == "" {
+		return nil
+	}
+
+	if wh.IsResolved() {
+		return b.messages.Delete(id, wh.GroupKey)
+	}
+
+	return b.messages.Set(id, wh.GroupKey, msg)
 }
 
-func (b *Bot) RegisterReceiver(receiver int64) error {
-	if err := b.ac.Config.RegisterReceiver(receiver); err != nil {
+// RegisterReceiver registers receiver in alertmanager, identity
+// verified by identity provider is bound with receiver if given
+func (b *Bot) RegisterReceiver(receiver int64, identity *registration.Identity) error {
+	change, err := b.ac.Config.RegisterReceiver(receiver)
+	if err != nil {
 		return err
 	}
 
-	if _, err := b.ac.Reload(); err != nil {
+	if change != nil {
+		r := audit.Record{Chat: receiver, Action: "register", Before: change.Before, After: change.After}
+		if identity != nil {
+			r.Username = identity.Email
+			if r.Username == "" {
+				r.Username = identity.Subject
+			}
+		}
+		if err := b.audit.Add(r); err != nil {
+			log.Printf("failed to write audit record: %s", err)
+		}
+	}
+
+	if identity != nil {
+		if err := b.ids.Set(receiver, identity); err != nil {
+			return fmt.Errorf("failed to save receiver identity: %s", err)
+		}
+	}
+
+	if err := b.reload(receiver, change); err != nil {
 		return fmt.Errorf("failed to reload alertmanager: %s", err)
 	}
 
@@ -144,11 +294,17 @@ func (b *Bot) handleStopCommand(m telebot.Context) error {
 		return m.Send("first you have to go auth flow")
 	}
 
-	if err := b.ac.Config.DisableReceiver(m.Message().Chat.ID); err != nil {
-		return err
+	change, err := b.ac.Config.DisableReceiver(m.Message().Chat.ID)
+	if err != nil {
+		return b.configError(m, err)
 	}
+	b.record(m.Sender(), receiver, "disable", "", change)
 
-	if _, err := b.ac.Reload(); err != nil {
+	if err := b.ids.Delete(receiver); err != nil {
+		return fmt.Errorf("failed to delete receiver identity: %s", err)
+	}
+
+	if err := b.reload(receiver, change); err != nil {
 		return fmt.Errorf("failed to reload alertmanager: %s", err)
 	}
 
@@ -162,12 +318,12 @@ func (b *Bot) handleSubscribeCommand(m telebot.Context) error {
 	}
 
 	if ok, err := b.ac.Config.IsRouteExists(receiver, nil); ok {
-		return m.Send("You are already subscribed for all alert groups. Unsubscribe first.")
+		return m.Send(SubscribedToAllText)
 	} else if err != nil {
 		return fmt.Errorf("failed checking route existence: %s", err)
 	}
 
-	if err := b.createAlertRuleGroupPages(receiver); err != nil {
+	if err := b.createAlertRuleGroupPages(receiver, "/subscribe"); err != nil {
 		return fmt.Errorf("failed to create alert rule groups pages: %s", err)
 	}
 
@@ -176,34 +332,83 @@ func (b *Bot) handleSubscribeCommand(m telebot.Context) error {
 		return fmt.Errorf("failed to create inline keyboard: %s", err)
 	}
 
-	if _, err = b.ac.Reload(); err != nil {
+	return m.Send("Available alert groups:", &telebot.ReplyMarkup{InlineKeyboard: ikb})
+}
+
+func (b *Bot) handleSubscribeAllCommand(m telebot.Context) error {
+	receiver := m.Chat().ID
+	if err := b.checkAuth(receiver); err != nil {
+		return err
+	}
+
+	change, err := b.addRestrictedRoutes(receiver, nil)
+	if err == ErrForbidden {
+		return m.Send(ForbiddenText)
+	} else if err != nil {
+		return b.configError(m, fmt.Errorf("failed adding route for all alert groups: %w", err))
+	}
+	b.record(m.Sender(), receiver, "subscribe", "{}", change)
+
+	if err := b.reload(receiver, change); err != nil {
 		return fmt.Errorf("failed to reload alertmanager: %s", err)
 	}
 
-	return m.Send("Available alert groups:", &telebot.ReplyMarkup{InlineKeyboard: ikb})
+	return nil
 }
 
-func (b *Bot) handleSubscribeAllCommand(m telebot.Context) error {
+func (b *Bot) handleSubscribeAlertCommand(m telebot.Context) error {
 	receiver := m.Chat().ID
 	if err := b.checkAuth(receiver); err != nil {
 		return err
 	}
 
 	if ok, err := b.ac.Config.IsRouteExists(receiver, nil); ok {
-		return nil
+		return m.Send(SubscribedToAllText)
 	} else if err != nil {
 		return fmt.Errorf("failed checking route existence: %s", err)
 	}
 
-	if err := b.ac.Config.AddRoute(receiver, nil); err != nil {
-		return fmt.Errorf("failed adding route for all alert groups: %s", err)
+	if err := b.createAlertRuleGroupPages(receiver, "/alertgroup"); err != nil {
+		return fmt.Errorf("failed to create alert rule groups pages: %s", err)
 	}
 
-	if _, err := b.ac.Reload(); err != nil {
+	ikb, err := b.addPositionButtons(receiver)
+	if err != nil {
+		return fmt.Errorf("failed to create inline keyboard: %s", err)
+	}
+
+	return m.Send("Available alert groups:", &telebot.ReplyMarkup{InlineKeyboard: ikb})
+}
+
+func (b *Bot) handleSubscribeMatchersCommand(m telebot.Context) error {
+	receiver := m.Chat().ID
+	if err := b.checkAuth(receiver); err != nil {
+		return err
+	}
+
+	matchers, err := labels.ParseMatchers(m.Message().Payload)
+	if err != nil {
+		return m.Send(fmt.Sprintf("Failed to parse matchers: %s\n\n%s", err, MatchersUsageText))
+	}
+	if len(matchers) == 0 {
+		return m.Send(MatchersUsageText)
+	}
+
+	change, err := b.addRestrictedRoutes(receiver, matchers)
+	if err == ErrForbidden {
+		return m.Send(ForbiddenText)
+	} else if err == config.ErrSubscribedToAll {
+		return m.Send(SubscribedToAllText)
+	} else if err != nil {
+		return b.configError(m, fmt.Errorf("failed adding route for matchers: %w", err))
+	}
+	b.record(m.Sender(), receiver, "subscribe", labels.Matchers(matchers).String(), change)
+
+	if err := b.reload(receiver, change); err != nil {
 		return fmt.Errorf("failed to reload alertmanager: %s", err)
 	}
 
-	return nil
+	return m.Send(fmt.Sprintf("Subscribed to <code>%s</code>", html.EscapeString(labels.Matchers(matchers).String())))
 }
 
 func (b *Bot) handleUnsubscribeCommand(m telebot.Context) error {
@@ -213,7 +418,17 @@ func (b *Bot) handleUnsubscribeCommand(m telebot.Context) error {
 	}
 
 	if ok, err := b.ac.Config.IsRouteExists(receiver, nil); ok {
-		return b.ac.Config.RemoveRoute(receiver, nil)
+		change, err := b.ac.Config.RemoveRoute(receiver, nil)
+		if err != nil {
+			return b.configError(m, err)
+		}
+		b.record(m.Sender(), receiver, "unsubscribe", "{}", change)
+
+		if err := b.reload(receiver, change); err != nil {
+			return fmt.Errorf("failed to reload alertmanager: %s", err)
+		}
+
+		return nil
 	} else if err != nil {
 		return fmt.Errorf("failed checking route existence: %s", err)
 	}
@@ -227,10 +442,6 @@ func (b *Bot) handleUnsubscribeCommand(m telebot.Context) error {
 		return fmt.Errorf("failed to create inline keyboard: %s", err)
 	}
 
-	if _, err = b.ac.Reload(); err != nil {
-		return fmt.Errorf("failed to reload alertmanager: %s", err)
-	}
-
 	return m.Send("Active alert groups:", &telebot.ReplyMarkup{InlineKeyboard: ikb})
 }
 
@@ -245,21 +456,23 @@ func (b *Bot) handleAlertsCommand(m telebot.Context) error {
 	params["silenced"] = "false"
 	params["inhibited"] = "false"
 	params["unprocessed"] = "false"
-	alerts, err := b.ac.ListAlerts(strconv.FormatInt(receiver, 10), params)
+	r := b.ac.Config.ReceiverName(receiver)
+	alerts, err := b.ac.ListAlerts(r, params)
 	if err != nil {
 		return fmt.Errorf("failed to get alerts from alertmanager: %s", err)
 	}
 
-	text, err := b.ac.GetMessageText(alerts)
+	text, err := b.ac.GetMessageText(r, b.filterAlerts(receiver, alerts))
 	if err != nil {
 		return fmt.Errorf("failed generate text from alert list: %s", err)
 	}
-	text = truncateMessage(text)
 	if strings.ReplaceAll(text, "\n", "") == "" {
 		text = "no alerts"
 	}
 
-	return m.Send(text, telebot.NoPreview)
+	_, err = b.send(receiver, text, &telebot.SendOptions{DisableWebPagePreview: true})
+
+	return err
 }
 
 func (b *Bot) handleCallback(m telebot.Context) error {
@@ -268,18 +481,6 @@ func (b *Bot) handleCallback(m telebot.Context) error {
 		return err
 	}
 
-	// LOG IT?!!
-	// defer func() {
-	// 	if err := m.Delete(); err != nil {
-	// 		return fmt.Errorf("failed to delete old message: %s", err)
-	// 	}
-	// }
-	defer func() {
-		if err := m.Delete(); err != nil {
-			log.Printf("failed to delete callback message: %s", err)
-		}
-	}()
-
 	callback := m.Callback()
 	n := strings.Index(callback.Data, "|")
 	if n < 0 {
@@ -288,6 +489,34 @@ func (b *Bot) handleCallback(m telebot.Context) error {
 	unique := callback.Data[1:n]
 	data := callback.Data[n+len("|"):]
 
+	// these buttons are attached to messages, which must be kept
+	switch unique {
+	case "/silence":
+		return b.handleSilenceCallback(m, data)
+	case "/silenceinfo":
+		return b.handleSilenceInfoCallback(m, data)
+	case "/expire":
+		return b.handleExpireCallback(m, data)
+	case "/expireconfirm":
+		return b.handleExpireConfirmCallback(m, data)
+	case "/expirecancel":
+		return m.Delete()
+	case "/settings":
+		return b.handleSettingsCallback(m, data)
+	case "/settingsmenu":
+		return b.handleSettingsMenuCallback(m)
+	case "/setting":
+		return b.handleSettingCallback(m, data)
+	case "/sendresolved":
+		return b.handleSendResolvedCallback(m, data)
+	}
+
+	defer func() {
+		if err := m.Delete(); err != nil {
+			log.Printf("failed to delete callback message: %s", err)
+		}
+	}()
+
 	switch unique {
 	case "/page":
 		if err := b.switchPage(receiver, data); err != nil {
@@ -299,33 +528,91 @@ func (b *Bot) handleCallback(m telebot.Context) error {
 			return fmt.Errorf("failed to create inline keyboard: %s", err)
 		}
 
-		return m.Send("Available alert groups:", &telebot.ReplyMarkup{InlineKeyboard: ikb})
+		return m.Send(b.pageTitle(receiver), &telebot.ReplyMarkup{InlineKeyboard: ikb})
 	case "/subscribe":
-		group, err := b.findAlertGroupNameByPrefix(data)
+		group, err := b.tokens.Payload(data)
 		if err != nil {
-			return fmt.Errorf("not found alert group by given prefix %s: %s", data, err)
+			return m.Send("Button is expired, repeat command please.")
 		}
 
-		match := make(map[string]string)
-		match["alertgroup"] = group
-		if err := b.ac.Config.AddRoute(receiver, match); err != nil {
-			return err
+		var change *config.Change
+		if b.access(receiver).Unrestricted() {
+			match := make(map[string]string)
+			match["alertgroup"] = group
+			change, err = b.ac.Config.AddRoute(receiver, match)
+		} else {
+			var matcher *labels.Matcher
+			if matcher, err = labels.NewMatcher(labels.MatchEqual, "alertgroup", group); err != nil {
+				return fmt.Errorf("failed to create alertgroup matcher: %s", err)
+			}
+
+			change, err = b.addRestrictedRoutes(receiver, labels.Matchers{matcher})
+		}
+		if err == ErrForbidden {
+			return m.Send(ForbiddenText)
+		} else if err == config.ErrSubscribedToAll {
+			return m.Send(SubscribedToAllText)
+		} else if err != nil {
+			return b.configError(m, err)
 		}
+		b.record(m.Sender(), receiver, "subscribe", fmt.Sprintf("{alertgroup=%q}", group), change)
 
-		if _, err = b.ac.Reload(); err != nil {
+		if err := b.reload(receiver, change); err != nil {
+			return fmt.Errorf("failed to reload alertmanager: %s", err)
+		}
+	case "/alertgroup":
+		group, err := b.tokens.Payload(data)
+		if err != nil {
+			return m.Send("Button is expired, repeat command please.")
+		}
+
+		if err := b.createAlertNamePages(receiver, group); err != nil {
+			return fmt.Errorf("failed to create alert names pages: %s", err)
+		}
+
+		ikb, err := b.addPositionButtons(receiver)
+		if err != nil {
+			return fmt.Errorf("failed to create inline keyboard: %s", err)
+		}
+
+		return m.Send(b.pageTitle(receiver), &telebot.ReplyMarkup{InlineKeyboard: ikb})
+	case "/subscribealert":
+		name, err := b.tokens.Payload(data)
+		if err != nil {
+			return m.Send("Button is expired, repeat command please.")
+		}
+
+		matcher, err := labels.NewMatcher(labels.MatchEqual, string(model.AlertNameLabel), name)
+		if err != nil {
+			return fmt.Errorf("failed to create alertname matcher: %s", err)
+		}
+
+		change, err := b.addRestrictedRoutes(receiver, labels.Matchers{matcher})
+		if err == ErrForbidden {
+			return m.Send(ForbiddenText)
+		} else if err == config.ErrSubscribedToAll {
+			return m.Send(SubscribedToAllText)
+		} else if err != nil {
+			return b.configError(m, err)
+		}
+		b.record(m.Sender(), receiver, "subscribe", labels.Matchers{matcher}.String(), change)
+
+		if err := b.reload(receiver, change); err != nil {
 			return fmt.Errorf("failed to reload alertmanager: %s", err)
 		}
 	case "/unsubscribe":
-		match, err := b.ac.Config.FindMatchByPrefix(receiver, data)
+		name, err := b.tokens.Payload(data)
 		if err != nil {
-			return fmt.Errorf("failed to get match for given alert group prefix: %s", err)
+			return m.Send("Button is expired, repeat command please.")
 		}
 
-		if err := b.ac.Config.RemoveRoute(receiver, match); err != nil {
-			return err
+		change, err := b.ac.Config.RemoveRouteByName(receiver, name)
+		if err != nil {
+			return b.configError(m, err)
 		}
+		b.record(m.Sender(), receiver, "unsubscribe", name, change)
 
-		if _, err = b.ac.Reload(); err != nil {
+		if err := b.reload(receiver, change); err != nil {
 			return fmt.Errorf("failed to reload alertmanager: %s", err)
 		}
 	}
@@ -333,89 +620,128 @@ func (b *Bot) handleCallback(m telebot.Context) error {
 	return nil
 }
 
-func (b *Bot) createAlertRuleGroupPages(receiver int64) error {
+func (b *Bot) createAlertRuleGroupPages(receiver int64, unique string) error {
 	groups, err := b.getRuleGroupNames()
 	if err != nil {
 		return err
 	}
 
+	access := b.access(receiver)
+
 	var buttons [][]telebot.InlineButton
-	length := CallbackLimit - len("\f/subscribe")
 	for _, name := range groups {
-		data := name
-		if len(data) >= length {
-			data = data[:length-1]
+		if !access.MayAllow(groupLabels(name)) {
+			continue
 		}
 
 		buttons = append(
 			buttons,
 			[]telebot.InlineButton{
-				{Unique: "/subscribe", Text: name, Data: data},
+				{Unique: unique, Text: name, Data: b.tokens.Token(name)},
 			},
 		)
 	}
 
-	b.mux.Lock()
-	defer b.mux.Unlock()
+	b.setPages(receiver, "Available alert groups:", buttons)
 
-	pages := paginator.New(adapter.NewSliceAdapter(buttons), 10)
-	b.pages[receiver] = &pages
+	return nil
+}
+
+func (b *Bot) createAlertNamePages(receiver int64, group string) error {
+	names, err := b.getRuleAlertNames(group)
+	if err != nil {
+		return err
+	}
+
+	access := b.access(receiver)
+
+	var buttons [][]telebot.InlineButton
+	for _, name := range names {
+		if !access.MayAllow(alertLabels(group, name)) {
+			continue
+		}
+
+		buttons = append(
+			buttons,
+			[]telebot.InlineButton{
+				{Unique: "/subscribealert", Text: name, Data: b.tokens.Token(name)},
+			},
+		)
+	}
+
+	if len(buttons) == 0 {
+		return ErrNotFound
+	}
+
+	b.setPages(receiver, fmt.Sprintf("Available alerts of %s group:", group), buttons)
 
 	return nil
 }
 
 func (b *Bot) makeActiveSubscribePages(receiver int64) error {
-	conf, err := b.ac.Config.Get()
+	routes, err := b.ac.Config.Routes(receiver)
 	if err != nil {
 		return fmt.Errorf("failed to get alertmanager config: %s", err)
 	}
 
 	var buttons [][]telebot.InlineButton
-	r := strconv.FormatInt(receiver, 10)
-	length := CallbackLimit - len("\f/unsubscribe")
-	for _, value := range conf.Route.Routes {
-		if value.Receiver == r {
-			name := value.Match["alertgroup"]
-			data := name
-			if len(data) >= length {
-				data = data[:length-1]
-			}
-
-			buttons = append(
-				buttons,
-				[]telebot.InlineButton{
-					{Unique: "/unsubscribe", Text: name, Data: data},
-				},
-			)
-		}
+	for _, value := range routes {
+		name := config.RouteName(value)
+		buttons = append(
+			buttons,
+			[]telebot.InlineButton{
+				{Unique: "/unsubscribe", Text: name, Data: b.tokens.Token(name)},
+			},
+		)
 	}
 
 	if len(buttons) == 0 {
-		return fmt.Errorf("routes with receiver %s not found", r)
+		return fmt.Errorf("routes with receiver %d not found", receiver)
 	}
 
+	b.setPages(receiver, "Active alert groups:", buttons)
+
+	return nil
+}
+
+func (b *Bot) setPages(receiver int64, title string, buttons [][]telebot.InlineButton) {
 	b.mux.Lock()
 	defer b.mux.Unlock()
 
 	pages := paginator.New(adapter.NewSliceAdapter(buttons), 10)
 	b.pages[receiver] = &pages
+	b.titles[receiver] = title
+}
 
-	return nil
+// pageTitle returns title of receiver pages
+func (b *Bot) pageTitle(receiver int64) string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	return b.titles[receiver]
 }
 
 func (b *Bot) addPositionButtons(receiver int64) ([][]telebot.InlineButton, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	pages, ok := b.pages[receiver]
+	if !ok {
+		return nil, fmt.Errorf("pages of receiver %d aren't found", receiver)
+	}
+
 	buttons := make([][]telebot.InlineButton, 0)
-	err := (*b.pages[receiver]).Results(&buttons)
+	err := (*pages).Results(&buttons)
 	if err != nil {
 		return nil, err
 	}
 
-	hasNext, err := (*b.pages[receiver]).HasNext()
+	hasNext, err := (*pages).HasNext()
 	if err != nil {
 		return nil, err
 	}
 
-	hasPrev, err := (*b.pages[receiver]).HasPrev()
+	hasPrev, err := (*pages).HasPrev()
 	if err != nil {
 		return nil, err
 	}
@@ -449,35 +775,53 @@ func (b *Bot) addPositionButtons(receiver int64) ([][]telebot.InlineButton, erro
 }
 
 func (b *Bot) switchPage(receiver int64, direction string) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	pages, ok := b.pages[receiver]
+	if !ok {
+		return fmt.Errorf("pages of receiver %d aren't found", receiver)
+	}
+
 	var move int
 	var err error
 
 	switch direction {
 	case "next":
-		move, err = (*b.pages[receiver]).NextPage()
+		move, err = (*pages).NextPage()
 		if err != nil {
 			return err
 		}
 	case "prev":
-		move, err = (*b.pages[receiver]).PrevPage()
+		move, err = (*pages).PrevPage()
 		if err != nil {
 			return err
 		}
 	}
 
-	(*b.pages[receiver]).SetPage(move)
+	(*pages).SetPage(move)
 
 	return nil
 }
 
-func (b *Bot) getRuleGroupNames() ([]string, error) {
+// getRules returns alert rules discovered in kubernetes,
+// nothing is returned if bot runs without kube client
+func (b *Bot) getRules() []rules.Rule {
+	if b.kc == nil {
+		return nil
+	}
+
 	var r []rules.Rule
 	r = vm.Rules(b.kc)
 	r = append(r, prom.Rules(b.kc)...)
 
+	return r
+}
+
+func (b *Bot) getRuleGroupNames() ([]string, error) {
 	keys := make(map[string]struct{})
 	groups := make([]string, 0)
-	for _, rule := range r {
+	for _, rule := range b.getRules() {
 		for _, group := range rule.GetGroupNames() {
 			if _, ok := keys[group]; !ok {
 				keys[group] = struct{}{}
@@ -489,27 +833,87 @@ func (b *Bot) getRuleGroupNames() ([]string, error) {
 	return groups, nil
 }
 
-func (b *Bot) findAlertGroupNameByPrefix(prefix string) (string, error) {
-	groups, err := b.getRuleGroupNames()
-	if err != nil {
-		return "", err
+func (b *Bot) getRuleAlertNames(group string) ([]string, error) {
+	keys := make(map[string]struct{})
+	names := make([]string, 0)
+	for _, rule := range b.getRules() {
+		for _, name := range rule.GetAlertNames(group) {
+			if _, ok := keys[name]; !ok {
+				keys[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
 	}
 
-	for _, name := range groups {
-		if strings.HasPrefix(name, prefix) {
-			return name, nil
+	return names, nil
+}
+
+// reload applies given config change, if alertmanager rejects it, change is rolled back
+// and receiver is notified. Change isn't rolled back, if config was changed since then
+// or alertmanager is unreachable, config will be applied on the next reload then.
+func (b *Bot) reload(receiver int64, change *config.Change) error {
+	if change == nil {
+		return nil
+	}
+
+	err := b.ac.Reload()
+	if err == nil {
+		return nil
+	}
+
+	var re *alertmanager.ReloadError
+	if !errors.As(err, &re) {
+		return err
+	}
+
+	text := fmt.Sprintf("Alertmanager rejected config change: <code>%s</code>", html.EscapeString(err.Error()))
+	if rollback, rerr := b.ac.Config.Rollback(change); rerr != nil {
+		log.Printf("failed to rollback alertmanager config: %s", rerr)
+
+		text += "\nPrevious config couldn't be restored, ask administrator for help."
+	} else {
+		b.record(nil, receiver, "rollback", "", rollback)
+
+		if rerr := b.ac.Reload(); rerr != nil {
+			log.Printf("failed to reload alertmanager with previous config: %s", rerr)
+
+			text += "\nPrevious config is restored, but alertmanager reload failed again."
+		} else {
+			text += "\nPrevious config is restored."
 		}
 	}
 
-	return "", ErrNotFound
+	if _, serr := b.b.Send(telebot.ChatID(receiver), text); serr != nil {
+		log.Printf("failed to report reload failure to chat %d: %s", receiver, serr)
+	}
+
+	return err
+}
+
+// configError tells user why config change was rejected by validation,
+// other errors are returned as is
+func (b *Bot) configError(m telebot.Context, err error) error {
+	var ve *config.ValidationError
+	if !errors.As(err, &ve) {
+		return err
+	}
+
+	log.Printf("config change by %s in chat %d rejected: %s", getUserName(m.Sender()), m.Chat().ID, ve.Err)
+
+	return m.Send(fmt.Sprintf("Alertmanager config change was rejected: <code>%s</code>", html.EscapeString(ve.Err.Error())))
 }
 
 func (b *Bot) checkAuth(receiver int64) error {
 	if ok, err := b.ac.Config.IsReceiverExists(receiver); err != nil {
 		return err
 	} else if !ok {
+		token, err := b.ri.Issue(receiver)
+		if err != nil {
+			return fmt.Errorf("failed to issue registration token: %s", err)
+		}
+
 		id := telebot.ChatID(receiver)
-		if _, err := b.b.Send(id, fmt.Sprintf(AuthFlowTextTemplate, RegistrationURL, receiver), telebot.NoPreview); err != nil {
+		if _, err := b.b.Send(id, fmt.Sprintf(AuthFlowTextTemplate, RegistrationURL, receiver, url.QueryEscape(token)), telebot.NoPreview); err != nil {
 			return err
 		} else {
 			return ErrAuth
@@ -0,0 +1,202 @@
+package bot
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	prom "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/vcraescu/go-paginator/v2"
+	"gopkg.in/tucnak/telebot.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager"
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
+	"github.com/sputnik-systems/alertmanager_bot/internal/audit"
+	"github.com/sputnik-systems/alertmanager_bot/internal/registration"
+)
+
+// testContext is telebot context of callback query, other methods aren't implemented
+type testContext struct {
+	telebot.Context
+	chat     *telebot.Chat
+	callback *telebot.Callback
+	sent     []interface{}
+}
+
+func (c *testContext) Chat() *telebot.Chat {
+	return c.chat
+}
+
+func (c *testContext) Sender() *telebot.User {
+	return &telebot.User{ID: 1, Username: "user"}
+}
+
+func (c *testContext) Callback() *telebot.Callback {
+	return c.callback
+}
+
+func (c *testContext) Send(what interface{}, opts ...interface{}) error {
+	c.sent = append(c.sent, what)
+
+	return nil
+}
+
+func (c *testContext) Delete() error {
+	return nil
+}
+
+// newTestBot returns bot with alertmanager config in temporary file
+// and kube client, which returns given objects
+func newTestBot(t *testing.T, objs ...client.Object) *Bot {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/-/reload" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "alertmanager.yml")
+	if err := os.WriteFile(path, []byte("route:\n  receiver: default\nreceivers:\n- name: default\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := alertmanager.New(srv.URL, "http://bot/webhook", "", config.NewFileStorage(path), nil)
+	if err != nil {
+		t.Fatalf("failed to create alertmanager client: %s", err)
+	}
+
+	ids, err := registration.NewIdentities("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	al, err := audit.New("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &Bot{
+		pages:  make(map[int64]*paginator.Paginator),
+		titles: make(map[int64]string),
+		tokens: newCallbackRegistry(CallbackRegistrySize, CallbackTokenTTL),
+		kc:     fake.NewClientBuilder().WithObjects(objs...).Build(),
+		ac:     a,
+		ids:    ids,
+		audit:  al,
+	}
+}
+
+func TestPagesParallel(t *testing.T) {
+	b := &Bot{
+		pages:  make(map[int64]*paginator.Paginator),
+		titles: make(map[int64]string),
+	}
+
+	var buttons [][]telebot.InlineButton
+	for i := 0; i < 25; i++ {
+		buttons = append(buttons, []telebot.InlineButton{{Unique: "/subscribe", Text: fmt.Sprint(i)}})
+	}
+	b.setPages(100, "Available alert groups:", buttons)
+
+	// pages are changed and read by concurrent callbacks, run with -race
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if i%3 == 0 {
+				b.setPages(100, "Available alert groups:", buttons)
+
+				return
+			}
+			direction := "next"
+			if i%2 == 0 {
+				direction = "prev"
+			}
+			// switching beyond first or last page fails, it's fine here
+			_ = b.switchPage(100, direction)
+			if _, err := b.addPositionButtons(100); err != nil {
+				t.Errorf("failed to create inline keyboard: %s", err)
+			}
+			if title := b.pageTitle(100); title != "Available alert groups:" {
+				t.Errorf("unexpected title %q", title)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if _, err := b.addPositionButtons(200); err == nil {
+		t.Errorf("expected error for receiver without pages")
+	}
+}
+
+func TestSubscribeCallbackLongGroupNames(t *testing.T) {
+	// names share their first 64 bytes, so they can't be passed in callback data as is
+	prefix := strings.Repeat("kubernetes-system-", 4)
+	groups := []string{prefix + "controller-manager", prefix + "scheduler"}
+	rule := &prom.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "monitoring", Name: "kubernetes"},
+		Spec: prom.PrometheusRuleSpec{Groups: []prom.RuleGroup{
+			{Name: groups[0]},
+			{Name: groups[1]},
+		}},
+	}
+
+	b := newTestBot(t, rule)
+	if _, err := b.ac.Config.RegisterReceiver(100); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.createAlertRuleGroupPages(100, "/subscribe"); err != nil {
+		t.Fatalf("failed to create pages: %s", err)
+	}
+	ikb, err := b.addPositionButtons(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ikb) != len(groups) {
+		t.Fatalf("expected %d buttons, got %v", len(groups), ikb)
+	}
+
+	for _, row := range ikb {
+		button := row[0]
+		data := "\f" + button.Unique + "|" + button.Data
+		if len(data) > 64 {
+			t.Errorf("callback data of %s is longer than 64 bytes: %q", button.Text, data)
+		}
+
+		ctx := &testContext{
+			chat:     &telebot.Chat{ID: 100},
+			callback: &telebot.Callback{Data: data},
+		}
+		if err := b.handleCallback(ctx); err != nil {
+			t.Fatalf("failed to handle callback of %s: %s", button.Text, err)
+		}
+		if len(ctx.sent) != 0 {
+			t.Errorf("unexpected reply %v", ctx.sent)
+		}
+	}
+
+	routes, err := b.ac.Config.Routes(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range routes {
+		names = append(names, config.RouteName(r))
+	}
+	sort.Strings(names)
+	if fmt.Sprint(names) != fmt.Sprint(groups) {
+		t.Errorf("expected subscriptions to %v, got %v", groups, names)
+	}
+}
@@ -0,0 +1,131 @@
+package bot
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// callback tokens are kept for given time since last use, oldest tokens
+	// are evicted earlier, if registry size limit is reached
+	CallbackRegistrySize = 10000
+	CallbackTokenTTL     = 7 * 24 * time.Hour
+)
+
+var (
+	ErrCallbackExpired = errors.New("unknown callback token, button is expired")
+)
+
+type callbackEntry struct {
+	token   string
+	payload string
+	used    time.Time
+}
+
+// callbackRegistry maps short tokens to full callback payloads, because
+// telegram limits callback data to 64 bytes, which is not enough
+// for long alert group names or matchers
+type callbackRegistry struct {
+	size     int
+	ttl      time.Duration
+	hash     func(string) string
+	now      func() time.Time
+	tokens   map[string]*list.Element
+	payloads map[string]*list.Element
+	// entries ordered by last use, least recently used first
+	entries *list.List
+	mux     sync.Mutex
+}
+
+func newCallbackRegistry(size int, ttl time.Duration) *callbackRegistry {
+	return &callbackRegistry{
+		size:     size,
+		ttl:      ttl,
+		hash:     callbackToken,
+		now:      time.Now,
+		tokens:   make(map[string]*list.Element),
+		payloads: make(map[string]*list.Element),
+		entries:  list.New(),
+	}
+}
+
+// Token returns token for given payload, same payload gets same token
+// while it is kept in registry
+func (r *callbackRegistry) Token(payload string) string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	now := r.now()
+	r.evict(now)
+
+	if e, ok := r.payloads[payload]; ok {
+		e.Value.(*callbackEntry).used = now
+		r.entries.MoveToBack(e)
+
+		return e.Value.(*callbackEntry).token
+	}
+
+	token := r.hash(payload)
+	for i := 1; ; i++ {
+		if _, ok := r.tokens[token]; !ok {
+			break
+		}
+		// token collision, try another one
+		token = r.hash(payload + "\x00" + strconv.Itoa(i))
+	}
+
+	e := r.entries.PushBack(&callbackEntry{token: token, payload: payload, used: now})
+	r.tokens[token] = e
+	r.payloads[payload] = e
+
+	if r.entries.Len() > r.size {
+		r.remove(r.entries.Front())
+	}
+
+	return token
+}
+
+// Payload returns payload registered for given token
+func (r *callbackRegistry) Payload(token string) (string, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	now := r.now()
+	r.evict(now)
+
+	e, ok := r.tokens[token]
+	if !ok {
+		return "", ErrCallbackExpired
+	}
+	e.Value.(*callbackEntry).used = now
+	r.entries.MoveToBack(e)
+
+	return e.Value.(*callbackEntry).payload, nil
+}
+
+// evict removes entries, which aren't used longer than ttl
+func (r *callbackRegistry) evict(now time.Time) {
+	for e := r.entries.Front(); e != nil; e = r.entries.Front() {
+		if now.Sub(e.Value.(*callbackEntry).used) < r.ttl {
+			return
+		}
+		r.remove(e)
+	}
+}
+
+func (r *callbackRegistry) remove(e *list.Element) {
+	entry := r.entries.Remove(e).(*callbackEntry)
+	delete(r.tokens, entry.token)
+	delete(r.payloads, entry.payload)
+}
+
+func callbackToken(payload string) string {
+	sum := sha256.Sum256([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
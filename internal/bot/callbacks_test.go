@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// collidingHash returns same token for all payloads until suffix is added
+func collidingHash(payload string) string {
+	if !strings.Contains(payload, "\x00") {
+		return "collision"
+	}
+
+	return callbackToken(payload)
+}
+
+func TestCallbackRegistryCollisions(t *testing.T) {
+	r := newCallbackRegistry(10, time.Hour)
+	r.hash = collidingHash
+
+	names := []string{"aaa", "bbb", "ccc"}
+	tokens := make(map[string]string)
+	for _, name := range names {
+		token := r.Token(name)
+		if other, ok := tokens[token]; ok {
+			t.Fatalf("payloads %q and %q got same token %q", other, name, token)
+		}
+		tokens[token] = name
+	}
+
+	for token, name := range tokens {
+		payload, err := r.Payload(token)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if payload != name {
+			t.Errorf("expected payload %q for token %q, got %q", name, token, payload)
+		}
+	}
+
+	// same payload gets same token
+	for token, name := range tokens {
+		if got := r.Token(name); got != token {
+			t.Errorf("expected token %q for %q, got %q", token, name, got)
+		}
+	}
+}
+
+func TestCallbackRegistrySize(t *testing.T) {
+	r := newCallbackRegistry(2, time.Hour)
+
+	first := r.Token("first")
+	second := r.Token("second")
+	// used token is moved to the end of eviction queue
+	if _, err := r.Payload(first); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	third := r.Token("third")
+
+	if _, err := r.Payload(second); err != ErrCallbackExpired {
+		t.Errorf("expected least recently used token to be evicted, got %v", err)
+	}
+	for _, token := range []string{first, third} {
+		if _, err := r.Payload(token); err != nil {
+			t.Errorf("unexpected error for token %q: %s", token, err)
+		}
+	}
+	if n := r.entries.Len(); n != 2 || len(r.tokens) != 2 || len(r.payloads) != 2 {
+		t.Errorf("expected 2 entries, got %d", n)
+	}
+}
+
+func TestCallbackRegistryTTL(t *testing.T) {
+	now := time.Now()
+	r := newCallbackRegistry(10, time.Hour)
+	r.now = func() time.Time { return now }
+
+	old := r.Token("old")
+	now = now.Add(30 * time.Minute)
+	fresh := r.Token("fresh")
+	now = now.Add(45 * time.Minute)
+
+	if _, err := r.Payload(old); err != ErrCallbackExpired {
+		t.Errorf("expected expired token, got %v", err)
+	}
+	if payload, err := r.Payload(fresh); err != nil || payload != "fresh" {
+		t.Errorf("expected fresh payload, got %q, %v", payload, err)
+	}
+	if len(r.tokens) != 1 || len(r.payloads) != 1 {
+		t.Errorf("expired entries aren't removed")
+	}
+
+	// expired payload gets new token entry again
+	if token := r.Token("old"); token != old {
+		t.Errorf("expected same token %q, got %q", old, token)
+	}
+}
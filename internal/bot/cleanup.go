@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gopkg.in/tucnak/telebot.v3"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
+)
+
+const (
+	// alertmanager reload after receiver removal is repeated on failures
+	// given number of times, delay between attempts is doubled every time
+	RemovalReloadAttempts = 5
+	RemovalReloadDelay    = 5 * time.Second
+)
+
+var (
+	// send errors, after which chat will never get notifications
+	permanentErrors = []*telebot.APIError{
+		telebot.ErrBlockedByUser,
+		telebot.ErrUserIsDeactivated,
+		telebot.ErrNotStartedByUser,
+		telebot.ErrChatNotFound,
+		telebot.ErrBotKickedFromGroup,
+		telebot.ErrBotKickedFromSuperGroup,
+	}
+)
+
+// isPermanentError returns true if chat is unreachable for bot
+func isPermanentError(err error) bool {
+	var apiErr *telebot.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	for _, value := range permanentErrors {
+		if apiErr.Description == value.Description {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleMyChatMember removes receiver of chat, which bot was kicked from or blocked in
+func (b *Bot) handleMyChatMember(m telebot.Context) error {
+	u := m.ChatMember()
+	if u == nil || u.Chat == nil || u.NewChatMember == nil {
+		return nil
+	}
+
+	switch u.NewChatMember.Role {
+	case telebot.Left, telebot.Kicked:
+		return b.removeReceiver(u.Sender, u.Chat.ID, fmt.Sprintf("bot status is changed to %s", u.NewChatMember.Role))
+	}
+
+	return nil
+}
+
+// removeReceiver disables receiver of chat, which is unreachable for bot
+func (b *Bot) removeReceiver(u *telebot.User, receiver int64, reason string) error {
+	change, err := b.ac.Config.DisableReceiver(receiver)
+	if err == config.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to disable receiver %d: %s", receiver, err)
+	}
+	b.record(u, receiver, "remove", "", change)
+
+	log.Printf("receiver %d is removed: %s", receiver, reason)
+
+	if err := b.ids.Delete(receiver); err != nil {
+		log.Printf("failed to delete identity of receiver %d: %s", receiver, err)
+	}
+	if err := b.messages.DeleteReceiver(receiver); err != nil {
+		log.Printf("failed to delete messages of receiver %d: %s", receiver, err)
+	}
+
+	b.reloadRemoval(receiver, change)
+
+	return nil
+}
+
+// reloadRemoval reloads alertmanager after receiver removal in background. Removal
+// isn't rolled back and isn't reported to unreachable chat, failed reloads are logged
+// and repeated with growing delay.
+func (b *Bot) reloadRemoval(receiver int64, change *config.Change) {
+	if change == nil {
+		return
+	}
+
+	go func() {
+		delay := RemovalReloadDelay
+		for attempt := 1; ; attempt++ {
+			err := b.ac.Reload()
+			if err == nil {
+				return
+			}
+
+			log.Printf("failed to reload alertmanager after removal of receiver %d (attempt %d): %s", receiver, attempt, err)
+			if attempt == RemovalReloadAttempts {
+				return
+			}
+
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}()
+}
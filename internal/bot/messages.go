@@ -0,0 +1,123 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/tucnak/telebot.v3"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/storage"
+)
+
+const (
+	// messages older than this will not be edited anymore
+	MessageRetention = 7 * 24 * time.Hour
+)
+
+type storedMessage struct {
+	telebot.StoredMessage
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// messageStore keeps telegram messages sent for alert groups,
+// so they could be edited or replied later
+type messageStore struct {
+	path     string
+	messages map[string]storedMessage
+	mux      sync.Mutex
+}
+
+// newMessageStore loads messages from given file,
+// empty path means that messages will be kept in memory only
+func newMessageStore(path string) (*messageStore, error) {
+	s := &messageStore{
+		path:     path,
+		messages: make(map[string]storedMessage),
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	if err := storage.ReadJSON(path, &s.messages); err != nil {
+		return nil, fmt.Errorf("failed to load messages store: %s", err)
+	}
+
+	return s, nil
+}
+
+func messageKey(receiver int64, groupKey string) string {
+	return strconv.FormatInt(receiver, 10) + "/" + groupKey
+}
+
+func (s *messageStore) Get(receiver int64, groupKey string) (telebot.StoredMessage, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	m, ok := s.messages[messageKey(receiver, groupKey)]
+	if !ok || time.Since(m.UpdatedAt) > MessageRetention {
+		return telebot.StoredMessage{}, false
+	}
+
+	return m.StoredMessage, true
+}
+
+func (s *messageStore) Set(receiver int64, groupKey string, m *telebot.Message) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	msgID, chatID := m.MessageSig()
+	s.messages[messageKey(receiver, groupKey)] = storedMessage{
+		StoredMessage: telebot.StoredMessage{MessageID: msgID, ChatID: chatID},
+		UpdatedAt:     time.Now(),
+	}
+
+	return s.save()
+}
+
+func (s *messageStore) Delete(receiver int64, groupKey string) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	delete(s.messages, messageKey(receiver, groupKey))
+
+	return s.save()
+}
+
+// DeleteReceiver removes all messages sent to receiver
+func (s *messageStore) DeleteReceiver(receiver int64) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	prefix := messageKey(receiver, "")
+	for key := range s.messages {
+		if strings.HasPrefix(key, prefix) {
+			delete(s.messages, key)
+		}
+	}
+
+	return s.save()
+}
+
+// save writes messages to store file, should be called under lock
+func (s *messageStore) save() error {
+	for key, value := range s.messages {
+		if time.Since(value.UpdatedAt) > MessageRetention {
+			delete(s.messages, key)
+		}
+	}
+
+	if s.path == "" {
+		return nil
+	}
+
+	if err := storage.WriteJSON(s.path, s.messages); err != nil {
+		return fmt.Errorf("failed to save messages store: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/tucnak/telebot.v3"
+)
+
+func TestMessageStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.json")
+	s, err := newMessageStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []struct {
+		receiver int64
+		group    string
+		id       int
+	}{
+		{100, "{}:{alertname=\"a\"}", 1},
+		{100, "{}:{alertname=\"b\"}", 2},
+		{10, "{}:{alertname=\"a\"}", 3},
+		{200, "{}:{alertname=\"expired\"}", 4},
+		{200, "{}:{alertname=\"deleted\"}", 5},
+	}
+	for _, m := range messages {
+		if err := s.Set(m.receiver, m.group, &telebot.Message{ID: m.id, Chat: &telebot.Chat{ID: m.receiver}}); err != nil {
+			t.Fatalf("failed to store message: %s", err)
+		}
+	}
+
+	s.mux.Lock()
+	expired := s.messages[messageKey(200, "{}:{alertname=\"expired\"}")]
+	expired.UpdatedAt = time.Now().Add(-MessageRetention - time.Minute)
+	s.messages[messageKey(200, "{}:{alertname=\"expired\"}")] = expired
+	s.mux.Unlock()
+
+	if err := s.Delete(200, "{}:{alertname=\"deleted\"}"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteReceiver(100); err != nil {
+		t.Fatal(err)
+	}
+
+	// store is loaded from file, like after bot restart
+	loaded, err := newMessageStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		receiver int64
+		group    string
+		id       string
+		ok       bool
+	}{
+		{"stored message", 10, "{}:{alertname=\"a\"}", "3", true},
+		{"unknown group", 10, "{}:{alertname=\"b\"}", "", false},
+		{"message of deleted receiver", 100, "{}:{alertname=\"a\"}", "", false},
+		{"expired message", 200, "{}:{alertname=\"expired\"}", "", false},
+		{"deleted message", 200, "{}:{alertname=\"deleted\"}", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, store := range []*messageStore{s, loaded} {
+				m, ok := store.Get(tt.receiver, tt.group)
+				if ok != tt.ok || m.MessageID != tt.id {
+					t.Errorf("expected message %q, %t, got %q, %t", tt.id, tt.ok, m.MessageID, ok)
+				}
+				if ok && m.ChatID != tt.receiver {
+					t.Errorf("expected chat %d, got %d", tt.receiver, m.ChatID)
+				}
+			}
+		})
+	}
+
+	if len(loaded.messages) != 1 {
+		t.Errorf("expired and deleted messages are saved: %v", loaded.messages)
+	}
+}
@@ -0,0 +1,25 @@
+package bot
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	queueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "alertmanager_bot_send_queue_depth",
+		Help: "Number of notifications waiting for delivery.",
+	})
+	queueDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "alertmanager_bot_send_queue_dropped_total",
+		Help: "Number of notifications dropped because of full queue or delivery failure.",
+	}, []string{"reason"})
+	queueRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "alertmanager_bot_send_queue_retries_total",
+		Help: "Number of notifications delivered again after transient errors.",
+	})
+	sendRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "alertmanager_bot_send_retries_total",
+		Help: "Number of messages resent after telegram flood limit errors.",
+	})
+)
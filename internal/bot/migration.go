@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"gopkg.in/tucnak/telebot.v3"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
+)
+
+func (b *Bot) handleMigration(m telebot.Context) error {
+	from, to := m.Migration()
+
+	return b.migrateReceiver(from, to)
+}
+
+// migrateReceiver moves receiver of group upgraded to supergroup to the new chat id
+func (b *Bot) migrateReceiver(from, to int64) error {
+	change, err := b.ac.Config.MigrateReceiver(from, to)
+	if err == config.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to migrate receiver %d to %d: %s", from, to, err)
+	}
+	b.record(nil, to, "migrate", strconv.FormatInt(from, 10), change)
+
+	log.Printf("receiver %d is migrated to supergroup %d", from, to)
+
+	if err := b.ids.Move(from, to); err != nil {
+		log.Printf("failed to move identity of receiver %d: %s", from, err)
+	}
+	// messages of the old group can't be edited in supergroup
+	if err := b.messages.DeleteReceiver(from); err != nil {
+		log.Printf("failed to delete messages of receiver %d: %s", from, err)
+	}
+
+	if err := b.reload(to, change); err != nil {
+		return fmt.Errorf("failed to reload alertmanager: %s", err)
+	}
+
+	return nil
+}
+
+// migratedTo returns new chat id from "group migrated" send error
+func migratedTo(err error) (int64, bool) {
+	var apiErr *telebot.APIError
+	if !errors.As(err, &apiErr) || apiErr.Description != telebot.ErrGroupMigrated.Description {
+		return 0, false
+	}
+
+	id, err := strconv.ParseInt(fmt.Sprint(apiErr.Parameters["migrate_to_chat_id"]), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return id, true
+}
@@ -0,0 +1,65 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/tucnak/telebot.v3"
+)
+
+func TestMigratedTo(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		id       int64
+		ok       bool
+	}{
+		{
+			name:     "group is migrated",
+			response: `{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-1001234567890}}`,
+			id:       -1001234567890,
+			ok:       true,
+		},
+		{
+			name:     "migration without new chat id",
+			response: `{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat"}`,
+		},
+		{
+			name:     "bot is blocked",
+			response: `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`,
+		},
+		{
+			name:     "flood error",
+			response: `{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 5","parameters":{"retry_after":5}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// telegram api answers with fixture, so error is created by telebot as in production
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if _, err := w.Write([]byte(tt.response)); err != nil {
+					t.Errorf("failed to write response: %s", err)
+				}
+			}))
+			defer srv.Close()
+
+			tb, err := telebot.NewBot(telebot.Settings{URL: srv.URL, Token: "token", Offline: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = tb.Send(telebot.ChatID(-100), "text")
+			if err == nil {
+				t.Fatalf("expected send error")
+			}
+
+			id, ok := migratedTo(err)
+			if id != tt.id || ok != tt.ok {
+				t.Errorf("expected %d, %t, got %d, %t for error %v", tt.id, tt.ok, id, ok, err)
+			}
+		})
+	}
+}
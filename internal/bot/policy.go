@@ -0,0 +1,158 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+
+	amcfg "github.com/prometheus/alertmanager/config"
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager"
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
+	"github.com/sputnik-systems/alertmanager_bot/internal/policy"
+)
+
+// access returns alerts available for receiver according to its identity
+func (b *Bot) access(receiver int64) *policy.Access {
+	identity, _ := b.ids.Get(receiver)
+
+	return b.policy.Access(identity)
+}
+
+// addRestrictedRoutes adds receiver routes with given matchers, restricted
+// receivers get route per allowed matchers set, combined with given matchers
+func (b *Bot) addRestrictedRoutes(receiver int64, matchers labels.Matchers) (*config.Change, error) {
+	if len(matchers) == 0 && b.access(receiver).Unrestricted() {
+		return b.ac.Config.AddRoute(receiver, nil)
+	}
+
+	sets, err := b.restrictMatchers(receiver, matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := make([]amcfg.Matchers, 0, len(sets))
+	for _, set := range sets {
+		ms = append(ms, amcfg.Matchers(set))
+	}
+
+	return b.ac.Config.AddMatchersRoute(receiver, ms...)
+}
+
+// restrictMatchers returns given matchers for unrestricted receivers, restricted receivers
+// get set per allowed matchers set, which may match alerts, combined with given matchers
+func (b *Bot) restrictMatchers(receiver int64, matchers labels.Matchers) ([]labels.Matchers, error) {
+	access := b.access(receiver)
+	if access.Unrestricted() {
+		return []labels.Matchers{matchers}, nil
+	}
+
+	out := restrictSets(access, matchers)
+	if len(out) == 0 {
+		return nil, ErrForbidden
+	}
+
+	return out, nil
+}
+
+// restrictSets returns allowed matchers sets, which may match alerts, combined with given matchers
+func restrictSets(access *policy.Access, matchers labels.Matchers) []labels.Matchers {
+	known := make(model.LabelSet)
+	for _, m := range matchers {
+		if m.Type == labels.MatchEqual {
+			known[model.LabelName(m.Name)] = model.LabelValue(m.Value)
+		}
+	}
+
+	var out []labels.Matchers
+	for _, set := range access.Sets() {
+		if !policy.MayMatch(set, known) {
+			continue
+		}
+
+		ms := make(labels.Matchers, 0, len(matchers)+len(set))
+		ms = append(ms, matchers...)
+		ms = append(ms, set...)
+		out = append(out, ms)
+	}
+
+	return out
+}
+
+// restrictRoutes checks routes of receivers against access policy, which may be added
+// or changed after receivers are subscribed. Routes, which aren't allowed, are replaced
+// with routes combined with allowed matchers sets or removed, if no set may match them.
+func (b *Bot) restrictRoutes() error {
+	receivers, err := b.ac.Config.Receivers()
+	if err != nil {
+		return fmt.Errorf("failed to list receivers: %s", err)
+	}
+
+	for _, receiver := range receivers {
+		access := b.access(receiver)
+		if access.Unrestricted() {
+			continue
+		}
+
+		change, err := b.ac.Config.RestrictRoutes(receiver, func(ms labels.Matchers) ([]labels.Matchers, bool) {
+			if access.Covers(ms) {
+				return nil, true
+			}
+
+			return restrictSets(access, ms), false
+		})
+		if err != nil {
+			return fmt.Errorf("failed to restrict routes of receiver %d: %s", receiver, err)
+		}
+		if change == nil {
+			continue
+		}
+		b.record(nil, receiver, "restrict", "", change)
+
+		log.Printf("routes of receiver %d are restricted by access policy", receiver)
+
+		if err := b.reload(receiver, change); err != nil {
+			return fmt.Errorf("failed to reload alertmanager: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// silenceAllowed checks that silence affects only alerts available for receiver
+func (b *Bot) silenceAllowed(receiver int64, s *alertmanager.Silence) bool {
+	ms, err := s.LabelMatchers()
+	if err != nil {
+		log.Printf("failed to parse matchers of silence %s: %s", s.ID, err)
+
+		return false
+	}
+
+	return b.access(receiver).Covers(ms)
+}
+
+// filterAlerts returns alerts available for receiver
+func (b *Bot) filterAlerts(receiver int64, alerts []*model.Alert) []*model.Alert {
+	access := b.access(receiver)
+	if access.Unrestricted() {
+		return alerts
+	}
+
+	out := make([]*model.Alert, 0, len(alerts))
+	for _, a := range alerts {
+		if access.Allows(a.Labels) {
+			out = append(out, a)
+		}
+	}
+
+	return out
+}
+
+func groupLabels(group string) model.LabelSet {
+	return model.LabelSet{"alertgroup": model.LabelValue(group)}
+}
+
+func alertLabels(group, name string) model.LabelSet {
+	return model.LabelSet{"alertgroup": model.LabelValue(group), model.AlertNameLabel: model.LabelValue(name)}
+}
@@ -0,0 +1,223 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"gopkg.in/tucnak/telebot.v3"
+)
+
+const (
+	// number of attempts to send message after flood limit errors
+	MaxSendRetries = 5
+	// notification is delivered again after transient errors given number
+	// of times, delay between attempts is doubled every time
+	DeliveryAttempts = 5
+	DeliveryDelay    = 5 * time.Second
+	// idle chat rate limiters are removed with given interval
+	ChatLimiterCleanupInterval = time.Minute
+
+	// a few messages may be sent to chat at once, long notifications are split into several
+	chatBurst = 3
+)
+
+var (
+	ErrQueueFull = errors.New("send queue is full")
+)
+
+// sendQueue delivers notifications in background. Notifications of every chat are
+// delivered in order of arrival, while different chats don't wait for each other.
+type sendQueue struct {
+	size  int
+	depth int
+	delay time.Duration
+	chats map[int64][]func() error
+	mux   sync.Mutex
+}
+
+func newSendQueue(size int) *sendQueue {
+	return &sendQueue{
+		size:  size,
+		delay: DeliveryDelay,
+		chats: make(map[int64][]func() error),
+	}
+}
+
+// Push adds delivery job to chat queue, ErrQueueFull is returned if queue is full
+func (q *sendQueue) Push(chat int64, job func() error) error {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	if q.depth >= q.size {
+		queueDropped.WithLabelValues("full").Inc()
+
+		return ErrQueueFull
+	}
+	q.depth++
+	queueDepth.Set(float64(q.depth))
+
+	// chat queue exists only while its jobs are processed
+	jobs, running := q.chats[chat]
+	q.chats[chat] = append(jobs, job)
+	if !running {
+		go q.run(chat)
+	}
+
+	return nil
+}
+
+func (q *sendQueue) run(chat int64) {
+	for {
+		q.mux.Lock()
+		jobs := q.chats[chat]
+		if len(jobs) == 0 {
+			delete(q.chats, chat)
+			q.mux.Unlock()
+
+			return
+		}
+		job := jobs[0]
+		q.chats[chat] = jobs[1:]
+		q.mux.Unlock()
+
+		if err := q.do(chat, job); err != nil {
+			log.Printf("failed to deliver notification to chat %d: %s", chat, err)
+			queueDropped.WithLabelValues("failed").Inc()
+		}
+
+		q.mux.Lock()
+		q.depth--
+		queueDepth.Set(float64(q.depth))
+		q.mux.Unlock()
+	}
+}
+
+// do runs delivery job, job is repeated with growing delay after transient errors,
+// because webhook is already answered and alertmanager doesn't repeat it. Next jobs
+// of the chat wait for retries, so notifications order is kept.
+func (q *sendQueue) do(chat int64, job func() error) error {
+	delay := q.delay
+	for attempt := 1; ; attempt++ {
+		err := job()
+		if err == nil || !isTransientError(err) || attempt == DeliveryAttempts {
+			return err
+		}
+
+		log.Printf("failed to deliver notification to chat %d, retrying after %s: %s", chat, delay, err)
+		queueRetries.Inc()
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransientError returns true if telegram api is unreachable or fails temporarily
+func isTransientError(err error) bool {
+	var fe telebot.FloodError
+	if errors.As(err, &fe) {
+		return true
+	}
+
+	var apiErr *telebot.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code >= 500
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// rateLimiter keeps messages rate below telegram limits for all chats and every chat
+type rateLimiter struct {
+	global    *rate.Limiter
+	chatLimit rate.Limit
+	chats     map[int64]*chatLimiter
+	cleaned   time.Time
+	mux       sync.Mutex
+}
+
+type chatLimiter struct {
+	*rate.Limiter
+	used time.Time
+}
+
+// newRateLimiter returns limiter allowing given number of
+// messages per second globally and per minute for every chat
+func newRateLimiter(perSecond, perChatMinute float64) *rateLimiter {
+	return &rateLimiter{
+		global:    rate.NewLimiter(rate.Limit(perSecond), 1),
+		chatLimit: rate.Limit(perChatMinute / 60),
+		chats:     make(map[int64]*chatLimiter),
+		cleaned:   time.Now(),
+	}
+}
+
+// Wait blocks until message may be sent to chat
+func (l *rateLimiter) Wait(chat int64) error {
+	now := time.Now()
+
+	l.mux.Lock()
+	if now.Sub(l.cleaned) >= ChatLimiterCleanupInterval {
+		l.cleanup(now)
+	}
+	cl, ok := l.chats[chat]
+	if !ok {
+		cl = &chatLimiter{Limiter: rate.NewLimiter(l.chatLimit, chatBurst)}
+		l.chats[chat] = cl
+	}
+	cl.used = now
+	l.mux.Unlock()
+
+	if err := cl.Wait(context.Background()); err != nil {
+		return err
+	}
+
+	l.mux.Lock()
+	cl.used = time.Now()
+	l.mux.Unlock()
+
+	return l.global.Wait(context.Background())
+}
+
+// cleanup removes limiters of chats, which are idle long enough for
+// refilling all tokens, such limiters are the same as new ones
+func (l *rateLimiter) cleanup(now time.Time) {
+	l.cleaned = now
+	if l.chatLimit <= 0 {
+		return
+	}
+
+	idle := time.Duration(float64(chatBurst) / float64(l.chatLimit) * float64(time.Second))
+	for chat, cl := range l.chats {
+		if now.Sub(cl.used) > idle {
+			delete(l.chats, chat)
+		}
+	}
+}
+
+// call makes rate limited telegram api call for chat, call is repeated
+// after delay requested by telegram, if flood limit is exceeded
+func (b *Bot) call(chat int64, f func() (*telebot.Message, error)) (*telebot.Message, error) {
+	for i := 1; ; i++ {
+		if err := b.limiter.Wait(chat); err != nil {
+			return nil, err
+		}
+
+		msg, err := f()
+
+		var fe telebot.FloodError
+		if !errors.As(err, &fe) || i >= MaxSendRetries {
+			return msg, err
+		}
+
+		log.Printf("flood limit is exceeded for chat %d, retrying after %ds", chat, fe.RetryAfter)
+		sendRetries.Inc()
+
+		time.Sleep(time.Duration(fe.RetryAfter) * time.Second)
+	}
+}
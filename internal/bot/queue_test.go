@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/tucnak/telebot.v3"
+)
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("telebot: %w", &url.Error{Op: "Post", URL: "https://api.telegram.org", Err: errors.New("timeout")}), true},
+		{telebot.NewAPIError(502, "Bad Gateway"), true},
+		{telebot.FloodError{APIError: telebot.NewAPIError(429, "Too Many Requests"), RetryAfter: 1}, true},
+		{telebot.ErrBlockedByUser, false},
+		{telebot.NewAPIError(400, "Bad Request: message text is empty"), false},
+		{errors.New("failed to write messages store"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isTransientError(tt.err); got != tt.want {
+			t.Errorf("isTransientError(%v) = %t, expected %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSendQueueRetries(t *testing.T) {
+	q := newSendQueue(10)
+	q.delay = time.Millisecond
+
+	var mux sync.Mutex
+	var calls []string
+	var wg sync.WaitGroup
+	push := func(name string, errs ...error) {
+		wg.Add(1)
+		err := q.Push(100, func() error {
+			mux.Lock()
+			defer mux.Unlock()
+
+			calls = append(calls, name)
+			if len(errs) == 0 {
+				wg.Done()
+
+				return nil
+			}
+			err := errs[0]
+			errs = errs[1:]
+			if !isTransientError(err) {
+				wg.Done()
+			}
+
+			return err
+		})
+		if err != nil {
+			t.Fatalf("failed to push job: %s", err)
+		}
+	}
+
+	transient := telebot.NewAPIError(500, "Internal Server Error")
+	push("first", transient, transient)
+	push("second", telebot.ErrBlockedByUser)
+	push("third")
+	wg.Wait()
+
+	want := []string{"first", "first", "first", "second", "third"}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("expected calls %v, got %v", want, calls)
+	}
+}
+
+func TestSendQueueRetriesLimit(t *testing.T) {
+	q := newSendQueue(10)
+	q.delay = time.Millisecond
+
+	attempts := 0
+	err := q.do(100, func() error {
+		attempts++
+
+		return telebot.NewAPIError(500, "Internal Server Error")
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if attempts != DeliveryAttempts {
+		t.Errorf("expected %d attempts, got %d", DeliveryAttempts, attempts)
+	}
+}
+
+func TestRateLimiterCleanup(t *testing.T) {
+	// 60 messages per minute, so limiter is refilled in 3 seconds
+	l := newRateLimiter(1000, 60)
+	for _, chat := range []int64{1, 2} {
+		if err := l.Wait(chat); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	l.chats[1].used = now.Add(-4 * time.Second)
+	l.cleanup(now)
+
+	if _, ok := l.chats[1]; ok {
+		t.Errorf("idle chat limiter isn't removed")
+	}
+	if _, ok := l.chats[2]; !ok {
+		t.Errorf("recently used chat limiter is removed")
+	}
+}
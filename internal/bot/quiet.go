@@ -0,0 +1,277 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/alertmanager/timeinterval"
+	"gopkg.in/tucnak/telebot.v3"
+)
+
+const (
+	QuietUsageText = `Usage: <code>/quiet &lt;days&gt; [HH:MM-HH:MM], ... [except critical]</code>
+Example: <code>/quiet mon-fri 20:00-09:00, sat-sun except critical</code>
+Times are in UTC. Use <code>/quiet off</code> for removing quiet hours.`
+	QuietUnsupportedText = "Quiet hours are not supported with AlertmanagerConfig storage, because these resources can't contain mute time intervals."
+
+	exceptCriticalSuffix = "except critical"
+)
+
+var (
+	weekdayNames = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"}
+)
+
+func (b *Bot) handleQuietCommand(m telebot.Context) error {
+	receiver := m.Chat().ID
+	if err := b.checkAuth(receiver); err != nil {
+		return err
+	}
+	if !b.ac.Config.QuietHoursSupported() {
+		return m.Send(QuietUnsupportedText)
+	}
+
+	args := strings.ToLower(strings.TrimSpace(m.Message().Payload))
+	if args == "" {
+		intervals, exceptCritical, err := b.ac.Config.QuietHours(receiver)
+		if err != nil {
+			return fmt.Errorf("failed to get quiet hours: %s", err)
+		}
+		if len(intervals) == 0 {
+			return m.Send("Quiet hours are not set.\n\n" + QuietUsageText)
+		}
+
+		return m.Send(fmt.Sprintf("Quiet hours:\n%s\n\n%s", formatQuietHours(intervals, exceptCritical), QuietUsageText))
+	}
+
+	var intervals []timeinterval.TimeInterval
+	var exceptCritical bool
+	if args != "off" {
+		var err error
+		intervals, exceptCritical, err = parseQuietHours(args)
+		if err != nil {
+			return m.Send(fmt.Sprintf("Failed to parse quiet hours: %s\n\n%s", html.EscapeString(err.Error()), QuietUsageText))
+		}
+	}
+
+	change, err := b.ac.Config.SetQuietHours(receiver, intervals, exceptCritical)
+	if err != nil {
+		return b.configError(m, fmt.Errorf("failed to set quiet hours: %w", err))
+	}
+	b.record(m.Sender(), receiver, "quiet", args, change)
+
+	if err := b.reload(receiver, change); err != nil {
+		return fmt.Errorf("failed to reload alertmanager: %s", err)
+	}
+
+	if len(intervals) == 0 {
+		return m.Send("Quiet hours are removed")
+	}
+
+	return m.Send(fmt.Sprintf("Quiet hours are set:\n%s", formatQuietHours(intervals, exceptCritical)))
+}
+
+// parseQuietHours parses comma separated list of weekly windows. Window is
+// days range with optional time range, which may cross midnight.
+func parseQuietHours(in string) ([]timeinterval.TimeInterval, bool, error) {
+	in = strings.TrimSpace(in)
+	exceptCritical := strings.HasSuffix(in, exceptCriticalSuffix)
+	in = strings.TrimSpace(strings.TrimSuffix(in, exceptCriticalSuffix))
+
+	var out []timeinterval.TimeInterval
+	for _, window := range strings.Split(in, ",") {
+		fields := strings.Fields(window)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, false, fmt.Errorf("window %q must contain days and optional time range", strings.TrimSpace(window))
+		}
+
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return nil, false, err
+		}
+
+		start, end := 0, 24*60
+		if len(fields) == 2 {
+			if start, end, err = parseTimeRange(fields[1]); err != nil {
+				return nil, false, err
+			}
+		}
+
+		if start < end {
+			out = append(out, timeinterval.TimeInterval{
+				Times:    []timeinterval.TimeRange{{StartMinute: start, EndMinute: end}},
+				Weekdays: weekdayRanges(days),
+			})
+
+			continue
+		}
+
+		// window crossing midnight is split into evening and next morning parts
+		var next [7]bool
+		for i, ok := range days {
+			next[(i+1)%7] = ok
+		}
+		out = append(out,
+			timeinterval.TimeInterval{
+				Times:    []timeinterval.TimeRange{{StartMinute: start, EndMinute: 24 * 60}},
+				Weekdays: weekdayRanges(days),
+			},
+			timeinterval.TimeInterval{
+				Times:    []timeinterval.TimeRange{{StartMinute: 0, EndMinute: end}},
+				Weekdays: weekdayRanges(next),
+			},
+		)
+	}
+
+	return out, exceptCritical, nil
+}
+
+// parseDays parses single day, days range, "daily" or "weekends"
+func parseDays(in string) ([7]bool, error) {
+	var days [7]bool
+
+	switch in {
+	case "daily":
+		for i := range days {
+			days[i] = true
+		}
+
+		return days, nil
+	case "weekends":
+		days[0], days[6] = true, true
+
+		return days, nil
+	}
+
+	v := strings.SplitN(in, "-", 2)
+	begin, err := parseWeekday(v[0])
+	if err != nil {
+		return days, err
+	}
+	end := begin
+	if len(v) == 2 {
+		if end, err = parseWeekday(v[1]); err != nil {
+			return days, err
+		}
+	}
+
+	// ranges like fri-mon wrap through the end of the week
+	for i := begin; ; i = (i + 1) % 7 {
+		days[i] = true
+		if i == end {
+			break
+		}
+	}
+
+	return days, nil
+}
+
+func parseWeekday(in string) (int, error) {
+	// both full and abbreviated names are accepted
+	for i, day := range weekdayNames {
+		if len(in) >= 3 && strings.HasPrefix(day, in) {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown weekday %q", in)
+}
+
+// parseTimeRange returns minutes of day of HH:MM-HH:MM range
+func parseTimeRange(in string) (int, int, error) {
+	v := strings.SplitN(in, "-", 2)
+	if len(v) != 2 {
+		return 0, 0, fmt.Errorf("time range %q must be in HH:MM-HH:MM format", in)
+	}
+
+	start, err := parseTime(v[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseTime(v[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("time range %q is empty", in)
+	}
+	if start == 24*60 {
+		return 0, 0, fmt.Errorf("time range %q must not start at 24:00", in)
+	}
+	// 24:00 and 00:00 are the same ends of window crossing midnight
+	if end == 0 {
+		end = 24 * 60
+	}
+
+	return start, end, nil
+}
+
+func parseTime(in string) (int, error) {
+	v := strings.SplitN(in, ":", 2)
+	if len(v) != 2 {
+		return 0, fmt.Errorf("time %q must be in HH:MM format", in)
+	}
+
+	h, err := strconv.Atoi(v[0])
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("time %q has incorrect hours", in)
+	}
+	m, err := strconv.Atoi(v[1])
+	if err != nil || m < 0 || m > 59 || h == 24 && m != 0 {
+		return 0, fmt.Errorf("time %q has incorrect minutes", in)
+	}
+
+	return h*60 + m, nil
+}
+
+// weekdayRanges returns ranges of consecutive days from the set
+func weekdayRanges(days [7]bool) []timeinterval.WeekdayRange {
+	var out []timeinterval.WeekdayRange
+	for i := 0; i < 7; i++ {
+		if !days[i] {
+			continue
+		}
+
+		begin := i
+		for i+1 < 7 && days[i+1] {
+			i++
+		}
+		out = append(out, timeinterval.WeekdayRange{InclusiveRange: timeinterval.InclusiveRange{Begin: begin, End: i}})
+	}
+
+	return out
+}
+
+func formatQuietHours(intervals []timeinterval.TimeInterval, exceptCritical bool) string {
+	lines := make([]string, 0, len(intervals)+1)
+	for _, ti := range intervals {
+		var days []string
+		for _, r := range ti.Weekdays {
+			if r.Begin == r.End {
+				days = append(days, weekdayNames[r.Begin][:3])
+			} else {
+				days = append(days, weekdayNames[r.Begin][:3]+"-"+weekdayNames[r.End][:3])
+			}
+		}
+		if len(days) == 0 {
+			days = append(days, "daily")
+		}
+
+		var times []string
+		for _, t := range ti.Times {
+			times = append(times, fmt.Sprintf("%02d:%02d-%02d:%02d", t.StartMinute/60, t.StartMinute%60, t.EndMinute/60, t.EndMinute%60))
+		}
+		if len(times) == 0 {
+			times = append(times, "00:00-24:00")
+		}
+
+		lines = append(lines, fmt.Sprintf("<code>%s %s</code>", strings.Join(days, ","), strings.Join(times, ",")))
+	}
+
+	if exceptCritical {
+		lines = append(lines, "Critical alerts are notified during quiet hours.")
+	}
+
+	return strings.Join(lines, "\n")
+}
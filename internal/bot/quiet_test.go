@@ -0,0 +1,207 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseQuietHours(t *testing.T) {
+	tests := []struct {
+		name           string
+		in             string
+		want           []string
+		exceptCritical bool
+		err            bool
+	}{
+		{
+			name: "window crossing midnight",
+			in:   "mon-fri 20:00-09:00",
+			want: []string{"mon-fri 20:00-24:00", "tue-sat 00:00-09:00"},
+		},
+		{
+			name: "saturday night crosses week end",
+			in:   "sat 23:00-01:00",
+			want: []string{"sat 23:00-24:00", "sun 00:00-01:00"},
+		},
+		{
+			name: "days range through week end",
+			in:   "sat-mon",
+			want: []string{"sun-mon,sat 00:00-24:00"},
+		},
+		{
+			name: "window till midnight",
+			in:   "fri-mon 22:00-00:00",
+			want: []string{"sun-mon,fri-sat 22:00-24:00"},
+		},
+		{
+			name:           "several windows except critical",
+			in:             "weekends, daily 22:00-06:00 except critical",
+			want:           []string{"sun,sat 00:00-24:00", "sun-sat 22:00-24:00", "sun-sat 00:00-06:00"},
+			exceptCritical: true,
+		},
+		{name: "empty", in: "", err: true},
+		{name: "empty window", in: "mon, ", err: true},
+		{name: "empty time range", in: "mon 10:00-10:00", err: true},
+		{name: "range starting at 24:00", in: "mon 24:00-06:00", err: true},
+		{name: "incorrect time", in: "mon 25:00-06:00", err: true},
+		{name: "unknown weekday", in: "funday", err: true},
+		{name: "too many fields", in: "mon 10:00-11:00 12:00-13:00", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intervals, exceptCritical, err := parseQuietHours(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected error, got %v", intervals)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if exceptCritical != tt.exceptCritical {
+				t.Errorf("expected except critical %t, got %t", tt.exceptCritical, exceptCritical)
+			}
+			got := strings.Split(formatQuietHours(intervals, false), "\n")
+			for i := range got {
+				got[i] = strings.TrimSuffix(strings.TrimPrefix(got[i], "<code>"), "</code>")
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("expected intervals %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		in   string
+		want [7]bool
+		err  bool
+	}{
+		{in: "wed", want: [7]bool{3: true}},
+		{in: "tuesday-thu", want: [7]bool{2: true, 3: true, 4: true}},
+		{in: "sat-mon", want: [7]bool{0: true, 1: true, 6: true}},
+		{in: "fri-mon", want: [7]bool{0: true, 1: true, 5: true, 6: true}},
+		{in: "weekends", want: [7]bool{0: true, 6: true}},
+		{in: "daily", want: [7]bool{true, true, true, true, true, true, true}},
+		{in: "mo", err: true},
+		{in: "mon-", err: true},
+	}
+
+	for _, tt := range tests {
+		days, err := parseDays(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected error, got %v", tt.in, days)
+			}
+
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.in, err)
+		}
+		if days != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.in, tt.want, days)
+		}
+	}
+}
+
+func TestWeekdayRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		days [7]bool
+		want string
+	}{
+		{"no days", [7]bool{}, "[]"},
+		{"whole week", [7]bool{true, true, true, true, true, true, true}, "[0-6]"},
+		{"week end and beginning", [7]bool{0: true, 1: true, 6: true}, "[0-1 6-6]"},
+		{"separate days", [7]bool{1: true, 3: true, 4: true}, "[1-1 3-4]"},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, r := range weekdayRanges(tt.days) {
+			got = append(got, fmt.Sprintf("%d-%d", r.Begin, r.End))
+		}
+		if fmt.Sprint(got) != tt.want {
+			t.Errorf("%s: expected %s, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestQuietHoursConfig(t *testing.T) {
+	b := newTestBot(t)
+	if _, err := b.ac.Config.RegisterReceiver(100); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ac.Config.AddRoute(100, map[string]string{"alertgroup": "node"}); err != nil {
+		t.Fatal(err)
+	}
+
+	intervals, exceptCritical, err := parseQuietHours("fri-mon 22:00-06:00 except critical")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.ac.Config.SetQuietHours(100, intervals, exceptCritical); err != nil {
+		t.Fatalf("failed to set quiet hours: %s", err)
+	}
+
+	conf, err := b.ac.Config.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := yaml.Marshal(map[string]interface{}{
+		"mute_time_intervals": conf.MuteTimeIntervals,
+		"routes":              conf.Route.Routes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `mute_time_intervals:
+- name: tg-100-quiet-except-critical
+  time_intervals:
+  - times:
+    - start_time: "22:00"
+      end_time: "24:00"
+    weekdays: ['sunday:monday', 'friday:saturday']
+  - times:
+    - start_time: "00:00"
+      end_time: "06:00"
+    weekdays: ['sunday:tuesday', saturday]
+routes:
+- receiver: tg-bot
+  continue: true
+  routes:
+  - receiver: tg-100
+    match:
+      alertgroup: node
+    mute_time_intervals:
+    - tg-100-quiet-except-critical
+    continue: true
+    routes:
+    - receiver: tg-100
+      matchers:
+      - severity="critical"
+      continue: false
+`
+	if string(out) != want {
+		t.Errorf("unexpected config:\n%s", out)
+	}
+
+	// intervals are read back as they are set
+	got, exceptCritical, err := b.ac.Config.QuietHours(100)
+	if err != nil || !exceptCritical {
+		t.Fatalf("expected quiet hours except critical, got %t, %v", exceptCritical, err)
+	}
+	if formatQuietHours(got, true) != formatQuietHours(intervals, true) {
+		t.Errorf("expected %s, got %s", formatQuietHours(intervals, true), formatQuietHours(got, true))
+	}
+}
@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"bytes"
+	"html"
+
+	"gopkg.in/tucnak/telebot.v3"
+)
+
+const (
+	// telegram limits message length by 4096 characters, while message is
+	// measured in bytes here, so limit is never exceeded
+	MessageLimit = 4096
+
+	LongMessageCaption = "Message is too long, full text is attached."
+)
+
+// send sends html message, which is split into several messages if it is too long.
+// Message is sent as html document, if it can't be split or needs more messages than
+// allowed. Reply is set for the first message and markup is attached to the last one,
+// the first message is returned.
+func (b *Bot) send(chat int64, text string, opts *telebot.SendOptions) (*telebot.Message, error) {
+	if len(text) <= MessageLimit {
+		return b.call(chat, func() (*telebot.Message, error) {
+			return b.b.Send(telebot.ChatID(chat), text, opts)
+		})
+	}
+
+	parts, ok := splitMessage(text, MessageLimit)
+	if !ok || b.maxParts > 0 && len(parts) > b.maxParts {
+		return b.sendDocument(chat, text, opts)
+	}
+
+	var first *telebot.Message
+	for i, part := range parts {
+		o := *opts
+		if i > 0 {
+			o.ReplyTo = nil
+		}
+		if i < len(parts)-1 {
+			o.ReplyMarkup = nil
+		}
+
+		msg, err := b.call(chat, func() (*telebot.Message, error) {
+			return b.b.Send(telebot.ChatID(chat), part, &o)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if first == nil {
+			first = msg
+		}
+	}
+
+	return first, nil
+}
+
+// sendDocument sends html message as html document
+func (b *Bot) sendDocument(chat int64, text string, opts *telebot.SendOptions) (*telebot.Message, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`<!DOCTYPE html><html><head><meta charset="utf-8"><title>`)
+	buf.WriteString(html.EscapeString(LongMessageCaption))
+	buf.WriteString(`</title></head><body style="white-space: pre-wrap; font-family: sans-serif">`)
+	buf.WriteString(text)
+	buf.WriteString(`</body></html>`)
+
+	return b.call(chat, func() (*telebot.Message, error) {
+		// reader is consumed by every attempt
+		doc := &telebot.Document{
+			File:     telebot.FromReader(bytes.NewReader(buf.Bytes())),
+			MIME:     "text/html",
+			FileName: "message.html",
+			Caption:  LongMessageCaption,
+		}
+
+		return b.b.Send(telebot.ChatID(chat), doc, opts)
+	})
+}
@@ -0,0 +1,330 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/tucnak/telebot.v3"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
+)
+
+// settingOption is a choice of route notification setting,
+// empty value resets setting to the one of parent route
+type settingOption struct {
+	text, value string
+}
+
+type setting struct {
+	name    string
+	options []settingOption
+}
+
+var (
+	// settings keys are short, because they are passed in callback data
+	settings = map[string]setting{
+		"gb": {
+			name: "group_by",
+			options: []settingOption{
+				{"by alertname", "alertname"},
+				{"by alertgroup", "alertgroup"},
+				{"by all labels", "..."},
+				{"default", ""},
+			},
+		},
+		"gw": {
+			name: "group_wait",
+			options: []settingOption{
+				{"wait 10s", "10s"},
+				{"wait 30s", "30s"},
+				{"wait 1m", "1m"},
+				{"default", ""},
+			},
+		},
+		"gi": {
+			name: "group_interval",
+			options: []settingOption{
+				{"every 1m", "1m"},
+				{"every 5m", "5m"},
+				{"every 15m", "15m"},
+				{"default", ""},
+			},
+		},
+		"ri": {
+			name: "repeat_interval",
+			options: []settingOption{
+				{"repeat 1h", "1h"},
+				{"repeat 4h", "4h"},
+				{"repeat 24h", "24h"},
+				{"default", ""},
+			},
+		},
+	}
+	settingsOrder = []string{"gb", "gw", "gi", "ri"}
+)
+
+func (b *Bot) handleSettingsCommand(m telebot.Context) error {
+	receiver := m.Chat().ID
+	if err := b.checkAuth(receiver); err != nil {
+		return err
+	}
+
+	text, markup, err := b.settingsMenu(receiver)
+	if err != nil {
+		return err
+	}
+
+	return m.Send(text, markup)
+}
+
+func (b *Bot) handleSettingsMenuCallback(m telebot.Context) error {
+	text, markup, err := b.settingsMenu(m.Chat().ID)
+	if err != nil {
+		return err
+	}
+
+	return m.Edit(text, markup)
+}
+
+// settingsMenu returns subscriptions list for choosing settings target
+func (b *Bot) settingsMenu(receiver int64) (string, *telebot.ReplyMarkup, error) {
+	routes, err := b.ac.Config.Routes(receiver)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get receiver routes: %s", err)
+	}
+
+	sendResolved, err := b.ac.Config.SendResolved(receiver)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get receiver config: %s", err)
+	}
+
+	var ikb [][]telebot.InlineButton
+	if len(routes) > 0 {
+		ikb = append(ikb, []telebot.InlineButton{{Unique: "/settings", Text: "All subscriptions", Data: b.tokens.Token("")}})
+	}
+	for _, r := range routes {
+		name := config.RouteName(r)
+		ikb = append(ikb, []telebot.InlineButton{{Unique: "/settings", Text: name, Data: b.tokens.Token(name)}})
+	}
+
+	resolved := telebot.InlineButton{Unique: "/sendresolved", Text: "Resolved notifications: on", Data: "off"}
+	if !sendResolved {
+		resolved.Text, resolved.Data = "Resolved notifications: off", "on"
+	}
+	ikb = append(ikb, []telebot.InlineButton{resolved})
+
+	text := "Choose subscription to configure:"
+	if len(routes) == 0 {
+		text = "There are no subscriptions to configure yet."
+	}
+
+	return text, &telebot.ReplyMarkup{InlineKeyboard: ikb}, nil
+}
+
+func (b *Bot) handleSettingsCallback(m telebot.Context, data string) error {
+	name, err := b.tokens.Payload(data)
+	if err != nil {
+		return m.Send("Button is expired, repeat command please.")
+	}
+
+	text, markup, err := b.settingsView(m.Chat().ID, name)
+	if err != nil {
+		return err
+	}
+
+	return m.Edit(text, markup)
+}
+
+// settingsView returns current settings of subscription with given name,
+// all chat subscriptions are shown if name is empty
+func (b *Bot) settingsView(receiver int64, name string) (string, *telebot.ReplyMarkup, error) {
+	routes, err := b.ac.Config.Routes(receiver)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get receiver routes: %s", err)
+	}
+
+	var current []config.RouteSettings
+	for _, r := range routes {
+		if name == "" || config.RouteName(r) == name {
+			current = append(current, config.GetRouteSettings(r))
+		}
+	}
+	if len(current) == 0 {
+		return "Subscription is not found, repeat command please.", &telebot.ReplyMarkup{}, nil
+	}
+
+	title := "all subscriptions"
+	if name != "" {
+		title = name
+	}
+
+	lines := []string{fmt.Sprintf("Settings of <b>%s</b>:", html.EscapeString(title))}
+	token := b.tokens.Token(name)
+
+	var ikb [][]telebot.InlineButton
+	for _, key := range settingsOrder {
+		s := settings[key]
+		value, same := settingValue(key, current[0]), true
+		for _, c := range current[1:] {
+			if settingValue(key, c) != value {
+				same = false
+			}
+		}
+
+		switch {
+		case !same:
+			lines = append(lines, fmt.Sprintf("%s: <i>differs</i>", s.name))
+		case value == "":
+			lines = append(lines, fmt.Sprintf("%s: <i>default</i>", s.name))
+		default:
+			lines = append(lines, fmt.Sprintf("%s: <code>%s</code>", s.name, html.EscapeString(value)))
+		}
+
+		row := make([]telebot.InlineButton, 0, len(s.options))
+		for _, o := range s.options {
+			text := o.text
+			if same && o.value == value {
+				text = "✓ " + text
+			}
+
+			row = append(row, telebot.InlineButton{
+				Unique: "/setting",
+				Text:   text,
+				Data:   fmt.Sprintf("%s %s %s", key, optionData(o.value), token),
+			})
+		}
+		ikb = append(ikb, row)
+	}
+	ikb = append(ikb, []telebot.InlineButton{{Unique: "/settingsmenu", Text: "« Back"}})
+
+	return strings.Join(lines, "\n"), &telebot.ReplyMarkup{InlineKeyboard: ikb}, nil
+}
+
+func (b *Bot) handleSettingCallback(m telebot.Context, data string) error {
+	receiver := m.Chat().ID
+
+	v := strings.Split(data, " ")
+	if len(v) != 3 {
+		return fmt.Errorf("unexpected setting callback data: %s", data)
+	}
+
+	s, ok := settings[v[0]]
+	if !ok {
+		return fmt.Errorf("unknown setting: %s", v[0])
+	}
+
+	name, err := b.tokens.Payload(v[2])
+	if err != nil {
+		return m.Send("Button is expired, repeat command please.")
+	}
+
+	value := optionValue(v[1])
+	var d *model.Duration
+	if value != "" && v[0] != "gb" {
+		pd, err := model.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("failed to parse setting duration: %s", err)
+		}
+		d = &pd
+	}
+
+	change, err := b.ac.Config.UpdateRouteSettings(receiver, name, func(rs *config.RouteSettings) {
+		switch v[0] {
+		case "gb":
+			rs.GroupBy = nil
+			if value != "" {
+				rs.GroupBy = []string{value}
+			}
+		case "gw":
+			rs.GroupWait = d
+		case "gi":
+			rs.GroupInterval = d
+		case "ri":
+			rs.RepeatInterval = d
+		}
+	})
+	if err == config.ErrNotFound {
+		return m.Respond(&telebot.CallbackResponse{Text: "Subscription is not found"})
+	} else if err != nil {
+		return b.configError(m, err)
+	}
+	b.record(m.Sender(), receiver, "settings", fmt.Sprintf("%s %s=%s", name, s.name, value), change)
+
+	if err := b.reload(receiver, change); err != nil {
+		return fmt.Errorf("failed to reload alertmanager: %s", err)
+	}
+
+	if err := m.Respond(&telebot.CallbackResponse{Text: "Settings are saved"}); err != nil {
+		return err
+	}
+
+	text, markup, err := b.settingsView(receiver, name)
+	if err != nil {
+		return err
+	}
+
+	return m.Edit(text, markup)
+}
+
+func (b *Bot) handleSendResolvedCallback(m telebot.Context, data string) error {
+	receiver := m.Chat().ID
+
+	change, err := b.ac.Config.SetSendResolved(receiver, data == "on")
+	if err != nil {
+		return b.configError(m, err)
+	}
+	b.record(m.Sender(), receiver, "settings", "send_resolved="+data, change)
+
+	if err := b.reload(receiver, change); err != nil {
+		return fmt.Errorf("failed to reload alertmanager: %s", err)
+	}
+
+	if err := m.Respond(&telebot.CallbackResponse{Text: "Settings are saved"}); err != nil {
+		return err
+	}
+
+	return b.handleSettingsMenuCallback(m)
+}
+
+// settingValue returns string value of route setting with given key
+func settingValue(key string, s config.RouteSettings) string {
+	d := func(v *model.Duration) string {
+		if v == nil {
+			return ""
+		}
+
+		return v.String()
+	}
+
+	switch key {
+	case "gb":
+		return strings.Join(s.GroupBy, ",")
+	case "gw":
+		return d(s.GroupWait)
+	case "gi":
+		return d(s.GroupInterval)
+	case "ri":
+		return d(s.RepeatInterval)
+	}
+
+	return ""
+}
+
+// empty option value can't be passed in space separated callback data
+func optionData(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+func optionValue(data string) string {
+	if data == "-" {
+		return ""
+	}
+
+	return data
+}
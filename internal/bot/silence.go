@@ -0,0 +1,374 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+	"gopkg.in/tucnak/telebot.v3"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager"
+)
+
+const (
+	SilenceUsageText = `Usage: <code>/silence &lt;duration&gt; &lt;matchers&gt; [comment]</code>
+Example: <code>/silence 2h {alertname="Watchdog", namespace=~"kube-.*"} planned maintenance</code>`
+)
+
+var (
+	silenceDurations = []string{"1h", "4h", "24h"}
+)
+
+// silenceMarkup returns inline keyboard for silencing given alerts
+// or nil, if there is nothing to silence
+func (b *Bot) silenceMarkup(alerts []*model.Alert) *telebot.ReplyMarkup {
+	ls := commonFiringLabels(alerts)
+	if len(ls) == 0 {
+		return nil
+	}
+
+	token := b.silences.Token(silencePayload(ls))
+
+	row := make([]telebot.InlineButton, 0, len(silenceDurations))
+	for _, d := range silenceDurations {
+		row = append(row, telebot.InlineButton{
+			Unique: "/silence",
+			Text:   fmt.Sprintf("Silence %s", d),
+			Data:   fmt.Sprintf("%s %s", d, token),
+		})
+	}
+
+	return &telebot.ReplyMarkup{InlineKeyboard: [][]telebot.InlineButton{row}}
+}
+
+func (b *Bot) handleSilenceCommand(m telebot.Context) error {
+	receiver := m.Chat().ID
+	if err := b.checkAuth(receiver); err != nil {
+		return err
+	}
+
+	d, matchers, comment, err := parseSilenceArgs(m.Message().Payload)
+	if err != nil {
+		return m.Send(fmt.Sprintf("%s\n\n%s", html.EscapeString(err.Error()), SilenceUsageText))
+	}
+
+	if comment == "" {
+		comment = "Created from telegram"
+	}
+
+	ids, until, err := b.createSilences(receiver, matchers, d, getUserName(m.Sender()), comment)
+	if err == ErrForbidden {
+		return m.Send(ForbiddenText)
+	} else if err != nil {
+		return err
+	}
+
+	return m.Send(fmt.Sprintf("Silence <code>%s</code> created until %s", strings.Join(ids, ", "), until.Format(time.RFC1123)))
+}
+
+// createSilences creates silence with given matchers, restricted receivers
+// get silence per allowed matchers set, combined with given matchers
+func (b *Bot) createSilences(receiver int64, matchers labels.Matchers, d time.Duration, createdBy, comment string) ([]string, time.Time, error) {
+	sets, err := b.restrictMatchers(receiver, matchers)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var ids []string
+	var until time.Time
+	for _, set := range sets {
+		s := alertmanager.NewSilence(set, d, createdBy, comment)
+		id, err := b.ac.CreateSilence(s)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to create silence: %s", err)
+		}
+		ids = append(ids, id)
+		until = s.EndsAt
+	}
+
+	return ids, until, nil
+}
+
+func (b *Bot) handleSilenceCallback(m telebot.Context, data string) error {
+	v := strings.SplitN(data, " ", 2)
+	if len(v) != 2 {
+		return fmt.Errorf("unexpected silence callback data: %s", data)
+	}
+
+	d, err := model.ParseDuration(v[0])
+	if err != nil {
+		return fmt.Errorf("failed to parse silence duration: %s", err)
+	}
+
+	ls, err := b.silenceLabels(m.Chat().ID, v[1])
+	if err == ErrNotFound {
+		return m.Respond(&telebot.CallbackResponse{Text: "Alert is unknown, use /silence command instead"})
+	} else if err != nil {
+		return err
+	}
+
+	matchers, err := alertmanager.MatchersFromLabels(ls)
+	if err != nil {
+		return fmt.Errorf("failed to create silence matchers: %s", err)
+	}
+
+	ids, until, err := b.createSilences(m.Chat().ID, matchers, time.Duration(d), getUserName(m.Sender()), "Created from telegram")
+	if err == ErrForbidden {
+		return m.Respond(&telebot.CallbackResponse{Text: ForbiddenText})
+	} else if err != nil {
+		return err
+	}
+
+	if err := m.Respond(&telebot.CallbackResponse{Text: fmt.Sprintf("Silenced for %s", v[0])}); err != nil {
+		return err
+	}
+
+	return m.Reply(fmt.Sprintf("Silence <code>%s</code> created by %s until %s", strings.Join(ids, ", "), html.EscapeString(getUserName(m.Sender())), until.Format(time.RFC1123)))
+}
+
+// silenceLabels returns labels of silence button token. Tokens are kept in memory,
+// so after bot restart labels are looked up in firing alerts of receiver.
+func (b *Bot) silenceLabels(receiver int64, token string) (model.LabelSet, error) {
+	payload, err := b.silences.Payload(token)
+	if err == ErrCallbackExpired {
+		payload, err = b.findSilencePayload(receiver, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ls model.LabelSet
+	if err := json.Unmarshal([]byte(payload), &ls); err != nil {
+		return nil, fmt.Errorf("failed to parse silence labels: %s", err)
+	}
+
+	return ls, nil
+}
+
+// findSilencePayload returns payload of alert group or single alert of receiver,
+// which has given silence button token
+func (b *Bot) findSilencePayload(receiver int64, token string) (string, error) {
+	groups, err := b.ac.ListAlertGroups(b.ac.Config.ReceiverName(receiver), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to list alert groups: %s", err)
+	}
+
+	for _, group := range groups {
+		alerts := group.ModelAlerts()
+		candidates := []model.LabelSet{commonFiringLabels(alerts)}
+		for _, a := range alerts {
+			candidates = append(candidates, a.Labels)
+		}
+
+		for _, ls := range candidates {
+			if len(ls) == 0 {
+				continue
+			}
+			if payload := silencePayload(ls); callbackToken(payload) == token {
+				return payload, nil
+			}
+		}
+	}
+
+	return "", ErrNotFound
+}
+
+// silencePayload returns labels encoded for silences registry, json
+// encoding sorts labels, so same labels always get same token
+func silencePayload(ls model.LabelSet) string {
+	data, _ := json.Marshal(ls)
+
+	return string(data)
+}
+
+func (b *Bot) handleSilencesCommand(m telebot.Context) error {
+	receiver := m.Chat().ID
+	if err := b.checkAuth(receiver); err != nil {
+		return err
+	}
+
+	if err := b.makeSilencesPages(receiver); err != nil {
+		if err == ErrNotFound {
+			return m.Send("There are no active silences")
+		}
+
+		return fmt.Errorf("failed to create silences pages: %s", err)
+	}
+
+	ikb, err := b.addPositionButtons(receiver)
+	if err != nil {
+		return fmt.Errorf("failed to create inline keyboard: %s", err)
+	}
+
+	return m.Send("Active silences:", &telebot.ReplyMarkup{InlineKeyboard: ikb})
+}
+
+func (b *Bot) handleSilenceInfoCallback(m telebot.Context, id string) error {
+	s, err := b.ac.GetSilence(id)
+	if err != nil {
+		return fmt.Errorf("failed to get silence: %s", err)
+	}
+	if !b.silenceAllowed(m.Chat().ID, s) {
+		return m.Respond(&telebot.CallbackResponse{Text: ForbiddenText})
+	}
+
+	text := fmt.Sprintf(
+		"%s\ncreated by: %s\nends at: %s\ncomment: %s",
+		s.MatchersString(), s.CreatedBy, s.EndsAt.Format(time.RFC1123), s.Comment,
+	)
+	// telegram allows only 200 characters in callback answers
+	if r := []rune(text); len(r) > 200 {
+		text = string(r[:199]) + "…"
+	}
+
+	return m.Respond(&telebot.CallbackResponse{Text: text, ShowAlert: true})
+}
+
+// handleExpireCallback asks for confirmation before expiring silence,
+// silences list is kept for expiring other silences
+func (b *Bot) handleExpireCallback(m telebot.Context, id string) error {
+	s, err := b.ac.GetSilence(id)
+	if err != nil {
+		return fmt.Errorf("failed to get silence: %s", err)
+	}
+	if !b.silenceAllowed(m.Chat().ID, s) {
+		return m.Respond(&telebot.CallbackResponse{Text: ForbiddenText})
+	}
+	if !s.IsActual() {
+		return m.Respond(&telebot.CallbackResponse{Text: "Silence is already expired"})
+	}
+
+	if err := m.Respond(); err != nil {
+		return err
+	}
+
+	ikb := [][]telebot.InlineButton{{
+		{Unique: "/expireconfirm", Text: "Expire", Data: id},
+		{Unique: "/expirecancel", Text: "Cancel"},
+	}}
+	text := fmt.Sprintf(
+		"Expire silence <code>%s</code> created by %s until %s?",
+		html.EscapeString(s.MatchersString()), html.EscapeString(s.CreatedBy), s.EndsAt.Format(time.RFC1123),
+	)
+
+	return m.Send(text, &telebot.ReplyMarkup{InlineKeyboard: ikb})
+}
+
+func (b *Bot) handleExpireConfirmCallback(m telebot.Context, id string) error {
+	s, err := b.ac.GetSilence(id)
+	if err != nil {
+		return fmt.Errorf("failed to get silence: %s", err)
+	}
+	if !b.silenceAllowed(m.Chat().ID, s) {
+		return m.Respond(&telebot.CallbackResponse{Text: ForbiddenText})
+	}
+
+	if err := b.ac.ExpireSilence(id); err != nil {
+		return fmt.Errorf("failed to expire silence: %s", err)
+	}
+
+	return m.Edit(fmt.Sprintf("Silence <code>%s</code> expired by %s", id, html.EscapeString(getUserName(m.Sender()))))
+}
+
+func (b *Bot) makeSilencesPages(receiver int64) error {
+	silences, err := b.ac.ListSilences()
+	if err != nil {
+		return fmt.Errorf("failed to list silences: %s", err)
+	}
+
+	var buttons [][]telebot.InlineButton
+	for _, s := range silences {
+		if !b.silenceAllowed(receiver, s) {
+			continue
+		}
+
+		text := fmt.Sprintf(
+			"%s · %s · until %s · %s",
+			s.MatchersString(), s.CreatedBy, s.EndsAt.Format("02 Jan 15:04"), s.Comment,
+		)
+
+		buttons = append(
+			buttons,
+			[]telebot.InlineButton{
+				{Unique: "/silenceinfo", Text: text, Data: s.ID},
+				{Unique: "/expire", Text: "Expire", Data: s.ID},
+			},
+		)
+	}
+
+	if len(buttons) == 0 {
+		return ErrNotFound
+	}
+
+	b.setPages(receiver, "Active silences:", buttons)
+
+	return nil
+}
+
+// parseSilenceArgs parses "<duration> <matchers> [comment]" string
+func parseSilenceArgs(payload string) (time.Duration, []*labels.Matcher, string, error) {
+	payload = strings.TrimSpace(payload)
+	v := strings.SplitN(payload, " ", 2)
+	if len(v) != 2 {
+		return 0, nil, "", fmt.Errorf("duration and matchers are required")
+	}
+
+	d, err := model.ParseDuration(v[0])
+	if err != nil {
+		return 0, nil, "", fmt.Errorf("failed to parse duration: %s", err)
+	}
+
+	rest := strings.TrimSpace(v[1])
+	var ms, comment string
+	if strings.HasPrefix(rest, "{") {
+		n := strings.Index(rest, "}")
+		if n < 0 {
+			return 0, nil, "", fmt.Errorf("matchers closing bracket not found")
+		}
+		ms, comment = rest[:n+1], rest[n+1:]
+	} else {
+		v = strings.SplitN(rest, " ", 2)
+		ms = v[0]
+		if len(v) == 2 {
+			comment = v[1]
+		}
+	}
+
+	matchers, err := labels.ParseMatchers(ms)
+	if err != nil {
+		return 0, nil, "", fmt.Errorf("failed to parse matchers: %s", err)
+	}
+	if len(matchers) == 0 {
+		return 0, nil, "", fmt.Errorf("at least one matcher is required")
+	}
+
+	return time.Duration(d), matchers, strings.TrimSpace(comment), nil
+}
+
+// commonFiringLabels returns labels shared by all firing alerts
+func commonFiringLabels(alerts []*model.Alert) model.LabelSet {
+	var ls model.LabelSet
+	for _, a := range alerts {
+		if a.Status() != model.AlertFiring {
+			continue
+		}
+
+		if ls == nil {
+			ls = a.Labels.Clone()
+
+			continue
+		}
+
+		for k, v := range ls {
+			if a.Labels[k] != v {
+				delete(ls, k)
+			}
+		}
+	}
+
+	return ls
+}
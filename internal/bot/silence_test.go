@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager"
+	"github.com/sputnik-systems/alertmanager_bot/internal/alertmanager/config"
+)
+
+func newTestSilencesBot(t *testing.T, groups interface{}) *Bot {
+	t.Helper()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/alerts/groups" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(groups); err != nil {
+			t.Errorf("failed to encode response: %s", err)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "alertmanager.yml")
+	a, err := alertmanager.New(srv.URL, "http://bot/webhook", "", config.NewFileStorage(path), nil)
+	if err != nil {
+		t.Fatalf("failed to create alertmanager client: %s", err)
+	}
+
+	return &Bot{ac: a, silences: newCallbackRegistry(CallbackRegistrySize, CallbackTokenTTL)}
+}
+
+func TestSilenceLabels(t *testing.T) {
+	first := model.LabelSet{"alertname": "test", "instance": "a"}
+	second := model.LabelSet{"alertname": "test", "instance": "b"}
+	b := newTestSilencesBot(t, []map[string]interface{}{
+		{
+			"labels":   map[string]string{"alertname": "test"},
+			"receiver": map[string]string{"name": "tg-100"},
+			"alerts": []map[string]interface{}{
+				{"labels": first, "startsAt": "2021-11-01T00:00:00Z"},
+				{"labels": second, "startsAt": "2021-11-01T00:00:00Z"},
+			},
+		},
+	})
+
+	// token of notification, which is sent before bot restart
+	common := model.LabelSet{"alertname": "test"}
+	tests := []struct {
+		name  string
+		token string
+		want  model.LabelSet
+	}{
+		{"known token", b.silences.Token(silencePayload(second)), second},
+		{"group token after restart", callbackToken(silencePayload(common)), common},
+		{"alert token after restart", callbackToken(silencePayload(first)), first},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ls, err := b.silenceLabels(100, tt.token)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !ls.Equal(tt.want) {
+				t.Errorf("expected labels %v, got %v", tt.want, ls)
+			}
+		})
+	}
+
+	if _, err := b.silenceLabels(100, callbackToken(silencePayload(model.LabelSet{"alertname": "resolved"}))); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound for unknown alert, got %v", err)
+	}
+}
+
+func TestSilencePayload(t *testing.T) {
+	ls := model.LabelSet{"b": "2", "a": "1", "c": "3"}
+	for i := 0; i < 10; i++ {
+		if got := silencePayload(ls.Clone()); got != `{"a":"1","b":"2","c":"3"}` {
+			t.Fatalf("unexpected payload %s", got)
+		}
+	}
+}
+
+func TestCommonFiringLabels(t *testing.T) {
+	resolved := time.Now().Add(-time.Minute)
+	alerts := []*model.Alert{
+		{Labels: model.LabelSet{"alertname": "test", "instance": "a", "job": "node"}},
+		{Labels: model.LabelSet{"alertname": "test", "instance": "b", "job": "node"}},
+		{Labels: model.LabelSet{"alertname": "test", "instance": "c", "job": "other"}, EndsAt: resolved},
+	}
+
+	want := model.LabelSet{"alertname": "test", "job": "node"}
+	if ls := commonFiringLabels(alerts); !ls.Equal(want) {
+		t.Errorf("expected %v, got %v", want, ls)
+	}
+	if ls := commonFiringLabels(alerts[2:]); len(ls) != 0 {
+		t.Errorf("expected no labels for resolved alerts, got %v", ls)
+	}
+}
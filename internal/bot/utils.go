@@ -1,27 +1,152 @@
 package bot
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/tucnak/telebot.v3"
 )
 
-// Truncate very big message
-func truncateMessage(str string) string {
-	truncateMsg := str
-	if len(str) > 4095 { // telegram API can only support 4096 bytes per message
-		// log.Warn("msg", "Message is bigger than 4095, truncate...")
+// htmlTag is opening tag of telegram html markup
+type htmlTag struct {
+	name, text string
+}
+
+// splitMessage splits html message into parts not longer than limit bytes. Message is split
+// by empty lines, lines or any other place outside of tags and entities, tags opened at
+// split point are closed at the end of part and reopened in the next one. It returns
+// false if message can't be split, for example because of too long tags.
+func splitMessage(text string, limit int) ([]string, bool) {
+	var parts []string
+	for len(text) > limit {
+		cut, open := splitPoint(text, limit)
+		prefix := openTags(open)
+		if cut <= len(prefix) {
+			return nil, false
+		}
+
+		if part := strings.TrimRight(text[:cut], "\n"); part != "" {
+			parts = append(parts, part+closeTags(open))
+		}
+		text = prefix + strings.TrimLeft(text[cut:], "\n")
+	}
+
+	return append(parts, text), true
+}
+
+// splitPoint returns position for splitting text and tags opened at that position
+func splitPoint(text string, limit int) (int, []htmlTag) {
+	type point struct {
+		pos  int
+		open []htmlTag
+	}
+	var paragraph, line, any point
+
+	var open []htmlTag
+	for i := 0; i < len(text); {
+		if i+len(closeTags(open)) > limit {
+			break
+		}
+
+		p := point{i, append([]htmlTag{}, open...)}
+		any = p
+		if i > 0 && text[i-1] == '\n' {
+			line = p
+			if i > 1 && text[i-2] == '\n' {
+				paragraph = p
+			}
+		}
+
+		n := tokenLength(text[i:])
+		if text[i] == '<' {
+			open = updateTags(open, text[i:i+n])
+		}
+		i += n
+	}
+
+	// parts are split by alerts or lines, if they aren't too short
+	switch {
+	case paragraph.pos > limit/2:
+		return paragraph.pos, paragraph.open
+	case line.pos > limit/2:
+		return line.pos, line.open
+	default:
+		return any.pos, any.open
+	}
+}
+
+// tokenLength returns length of tag, entity or character at the beginning of text
+func tokenLength(text string) int {
+	switch text[0] {
+	case '<':
+		if n := strings.IndexByte(text, '>'); n != -1 {
+			return n + 1
+		}
+	case '&':
+		if n := strings.IndexByte(text, ';'); n != -1 && n <= 10 {
+			return n + 1
+		}
+	}
+
+	_, n := utf8.DecodeRuneInString(text)
+
+	return n
+}
+
+// updateTags returns tags opened after given tag
+func updateTags(open []htmlTag, tag string) []htmlTag {
+	name := strings.TrimPrefix(strings.Trim(tag, "<>"), "/")
+	if n := strings.IndexAny(name, " \t\n"); n != -1 {
+		name = name[:n]
+	}
 
-		// find the end of last alert, we do not want break the html tags
-		i := strings.LastIndex(str[0:4080], "\n\n") // 4080 + "\n<b>[SNIP]</b>" == 4095
-		if i > 1 {
-			truncateMsg = str[0:i] + "\n<b>[SNIP]</b>"
-		} else {
-			truncateMsg = "Message is too long... can't send.."
+	if !strings.HasPrefix(tag, "</") {
+		return append(open, htmlTag{name: name, text: tag})
+	}
 
-			// log.Warn("msg", "truncateMessage: Unable to find the end of last alert.")
+	for i := len(open) - 1; i >= 0; i-- {
+		if open[i].name == name {
+			return append(open[:i:i], open[i+1:]...)
 		}
+	}
+
+	return open
+}
+
+func openTags(open []htmlTag) string {
+	var out string
+	for _, tag := range open {
+		out += tag.text
+	}
+
+	return out
+}
+
+func closeTags(open []htmlTag) string {
+	var out string
+	for i := len(open) - 1; i >= 0; i-- {
+		out += "</" + open[i].name + ">"
+	}
+
+	return out
+}
+
+// Get human readable telegram user name
+func getUserName(u *telebot.User) string {
+	if u == nil {
+		return "telegram"
+	}
+
+	if u.Username != "" {
+		return u.Username
+	}
 
-		return truncateMsg
+	name := strings.TrimSpace(fmt.Sprintf("%s %s", u.FirstName, u.LastName))
+	if name == "" {
+		return strconv.FormatInt(u.ID, 10)
 	}
 
-	return truncateMsg
+	return name
 }
@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		parts []string
+		ok    bool
+	}{
+		{
+			name:  "short message",
+			text:  "<b>firing</b>",
+			limit: 20,
+			parts: []string{"<b>firing</b>"},
+			ok:    true,
+		},
+		{
+			name:  "split by empty line",
+			text:  "first alert\nline\n\nsecond alert\nline",
+			limit: 24,
+			parts: []string{"first alert\nline", "second alert\nline"},
+			ok:    true,
+		},
+		{
+			name:  "split by line",
+			text:  "first line\nsecond line\nthird line",
+			limit: 25,
+			parts: []string{"first line\nsecond line", "third line"},
+			ok:    true,
+		},
+		{
+			name:  "split without newlines",
+			text:  "abcdefghijklmnopqrstuvwxyz",
+			limit: 10,
+			parts: []string{"abcdefghij", "klmnopqrst", "uvwxyz"},
+			ok:    true,
+		},
+		{
+			name:  "nested tags are closed and reopened",
+			text:  "<b>bold <i>italic text</i></b>",
+			limit: 24,
+			parts: []string{"<b>bold <i>itali</i></b>", "<b><i>c text</i></b>"},
+			ok:    true,
+		},
+		{
+			name:  "tag with attributes is reopened as is",
+			text:  `<a href="http://x">link text</a>`,
+			limit: 28,
+			parts: []string{`<a href="http://x">link </a>`, `<a href="http://x">text</a>`},
+			ok:    true,
+		},
+		{
+			name:  "entities aren't split",
+			text:  "a &lt; b &amp;&amp; c",
+			limit: 10,
+			parts: []string{"a &lt; b ", "&amp;&amp;", " c"},
+			ok:    true,
+		},
+		{
+			name:  "multibyte runes aren't split",
+			text:  "привет мир",
+			limit: 7,
+			parts: []string{"при", "вет ", "мир"},
+			ok:    true,
+		},
+		{
+			name:  "tag longer than limit",
+			text:  `<a href="http://very-long-url">x</a>`,
+			limit: 20,
+			ok:    false,
+		},
+		{
+			name:  "reopened tags don't fit into limit",
+			text:  "<b><i><u>abcdef</u></i></b>",
+			limit: 20,
+			ok:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, ok := splitMessage(tt.text, tt.limit)
+			if ok != tt.ok {
+				t.Fatalf("expected ok %t, got %t with parts %q", tt.ok, ok, parts)
+			}
+			if !ok {
+				return
+			}
+
+			if strings.Join(parts, "|") != strings.Join(tt.parts, "|") {
+				t.Errorf("expected parts %q, got %q", tt.parts, parts)
+			}
+			for _, part := range parts {
+				if len(part) > tt.limit {
+					t.Errorf("part %q is longer than %d bytes", part, tt.limit)
+				}
+				if !utf8.ValidString(part) {
+					t.Errorf("part %q contains broken runes", part)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitPoint(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		limit int
+		pos   int
+		open  []string
+	}{
+		{
+			name:  "empty line is preferred",
+			text:  "aaaa\n\nbbbb\ncccc",
+			limit: 10,
+			pos:   6,
+		},
+		{
+			name:  "too short paragraph is skipped",
+			text:  "a\n\nbbbbbbbb\ncccc",
+			limit: 14,
+			pos:   12,
+		},
+		{
+			name:  "closing tags are reserved",
+			text:  "<b>abcdefgh</b>",
+			limit: 10,
+			pos:   6,
+			open:  []string{"b"},
+		},
+		{
+			name:  "closed tags aren't reopened",
+			text:  "<b>ab</b><i>cd</i>efgh",
+			limit: 19,
+			pos:   19,
+		},
+		{
+			name:  "entity isn't split",
+			text:  "ab&amp;cd",
+			limit: 5,
+			pos:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos, open := splitPoint(tt.text, tt.limit)
+			if pos != tt.pos {
+				t.Errorf("expected position %d, got %d", tt.pos, pos)
+			}
+
+			var names []string
+			for _, tag := range open {
+				names = append(names, tag.name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.open, ",") {
+				t.Errorf("expected open tags %v, got %v", tt.open, names)
+			}
+		})
+	}
+}
@@ -2,4 +2,6 @@ package rules
 
 type Rule interface {
 	GetGroupNames() []string
+	// GetAlertNames returns names of alerting rules in given group
+	GetAlertNames(group string) []string
 }
@@ -47,3 +47,20 @@ func (r *rule) GetGroupNames() []string {
 
 	return groups
 }
+
+func (r *rule) GetAlertNames(group string) []string {
+	alerts := make([]string, 0)
+	for _, g := range r.groups {
+		if g.Name != group {
+			continue
+		}
+
+		for _, value := range g.Rules {
+			if value.Alert != "" {
+				alerts = append(alerts, value.Alert)
+			}
+		}
+	}
+
+	return alerts
+}
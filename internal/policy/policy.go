@@ -0,0 +1,217 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v2"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/registration"
+)
+
+// Rule grants access to alerts selected by matchers for identities,
+// which are members of any given group, have given verified email or email domain.
+// Rule without groups, emails and domains is applied to everyone,
+// including chats registered without identity provider.
+// Rule without matchers grants access to all alerts.
+type Rule struct {
+	Groups   []string `yaml:"groups,omitempty"`
+	Emails   []string `yaml:"emails,omitempty"`
+	Domains  []string `yaml:"domains,omitempty"`
+	Matchers []string `yaml:"matchers,omitempty"`
+
+	matchers labels.Matchers
+}
+
+// Policy maps identities to alerts, which they are allowed to see and subscribe
+type Policy struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// Load reads policy from given file, nil policy is returned for empty path
+func Load(path string) (*Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %s", err)
+	}
+
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file: %s", err)
+	}
+
+	for i, rule := range p.Rules {
+		for _, value := range rule.Matchers {
+			ms, err := labels.ParseMatchers(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse matchers of rule %d: %s", i, err)
+			}
+			rule.matchers = append(rule.matchers, ms...)
+		}
+	}
+
+	return p, nil
+}
+
+// Access returns alerts access for given identity, identity may be nil
+func (p *Policy) Access(identity *registration.Identity) *Access {
+	if p == nil {
+		return &Access{all: true}
+	}
+
+	a := &Access{}
+	for _, rule := range p.Rules {
+		if !rule.applies(identity) {
+			continue
+		}
+
+		if len(rule.matchers) == 0 {
+			return &Access{all: true}
+		}
+
+		a.sets = append(a.sets, rule.matchers)
+	}
+
+	return a
+}
+
+func (r *Rule) applies(identity *registration.Identity) bool {
+	if len(r.Groups) == 0 && len(r.Emails) == 0 && len(r.Domains) == 0 {
+		return true
+	}
+
+	if identity == nil {
+		return false
+	}
+
+	for _, group := range identity.Groups {
+		for _, value := range r.Groups {
+			if value == group {
+				return true
+			}
+		}
+	}
+
+	if !identity.EmailVerified {
+		return false
+	}
+
+	email := strings.ToLower(identity.Email)
+	for _, value := range r.Emails {
+		if strings.ToLower(value) == email {
+			return true
+		}
+	}
+
+	if n := strings.LastIndex(email, "@"); n >= 0 {
+		for _, value := range r.Domains {
+			if strings.ToLower(value) == email[n+1:] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Access describes alerts available for some identity
+type Access struct {
+	all  bool
+	sets []labels.Matchers
+}
+
+// Unrestricted returns true if all alerts are available
+func (a *Access) Unrestricted() bool {
+	return a.all
+}
+
+// Sets returns matchers sets, alert is available if it matches any of them
+func (a *Access) Sets() []labels.Matchers {
+	return a.sets
+}
+
+// Allows checks that alert with given labels is available
+func (a *Access) Allows(ls model.LabelSet) bool {
+	if a.all {
+		return true
+	}
+
+	for _, set := range a.sets {
+		if set.Matches(ls) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Covers checks that alerts selected by given matchers are available, i.e. matchers
+// contain all matchers of some available set. It is used for silences, which
+// may be seen and changed only if they don't affect other alerts.
+func (a *Access) Covers(ms labels.Matchers) bool {
+	if a.all {
+		return true
+	}
+
+	for _, set := range a.sets {
+		if contains(ms, set) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contains checks that every matcher of set is in ms
+func contains(ms, set labels.Matchers) bool {
+	for _, m := range set {
+		var found bool
+		for _, value := range ms {
+			if value.Name == m.Name && value.Type == m.Type && value.Value == m.Value {
+				found = true
+
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MayAllow checks that alerts with given labels may be available.
+// Only matchers on given labels are taken into account, it is useful
+// for alert rules, when other alert labels are unknown until alert is fired.
+func (a *Access) MayAllow(ls model.LabelSet) bool {
+	if a.all {
+		return true
+	}
+
+	for _, set := range a.sets {
+		if MayMatch(set, ls) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MayMatch checks given labels only with matchers on these labels
+func MayMatch(set labels.Matchers, ls model.LabelSet) bool {
+	for _, m := range set {
+		if v, ok := ls[model.LabelName(m.Name)]; ok && !m.Matches(string(v)) {
+			return false
+		}
+	}
+
+	return true
+}
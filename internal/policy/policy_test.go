@@ -0,0 +1,89 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/registration"
+)
+
+func TestAccessCovers(t *testing.T) {
+	parse := func(s string) labels.Matchers {
+		ms, err := labels.ParseMatchers(s)
+		if err != nil {
+			t.Fatalf("failed to parse matchers %s: %s", s, err)
+		}
+
+		return ms
+	}
+
+	restricted := &Access{sets: []labels.Matchers{parse(`{team="payments"}`), parse(`{team="ops", env=~"prod|stage"}`)}}
+
+	tests := []struct {
+		name     string
+		access   *Access
+		matchers string
+		want     bool
+	}{
+		{"unrestricted", &Access{all: true}, `{alertname="Watchdog"}`, true},
+		{"no access", &Access{}, `{team="payments"}`, false},
+		{"allowed set", restricted, `{team="payments"}`, true},
+		{"allowed set with other matchers", restricted, `{alertname="Down", team="payments"}`, true},
+		{"all matchers of set", restricted, `{team="ops", env=~"prod|stage", job="node"}`, true},
+		{"part of set", restricted, `{team="ops"}`, false},
+		{"other value", restricted, `{team="billing"}`, false},
+		{"other match type", restricted, `{team=~"payments"}`, false},
+		{"broader silence", restricted, `{alertname="Down"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.access.Covers(parse(tt.matchers)); got != tt.want {
+				t.Errorf("expected %t, got %t", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPolicyAccess(t *testing.T) {
+	p := &Policy{Rules: []*Rule{
+		{Emails: []string{"admin@example.org"}},
+		{Domains: []string{"example.org"}, matchers: labels.Matchers{mustMatcher(t, "team", "payments")}},
+		{Groups: []string{"ops"}, matchers: labels.Matchers{mustMatcher(t, "team", "ops")}},
+	}}
+
+	tests := []struct {
+		name         string
+		identity     *registration.Identity
+		unrestricted bool
+		sets         int
+	}{
+		{"no identity", nil, false, 0},
+		{"verified email", &registration.Identity{Email: "Admin@example.org", EmailVerified: true}, true, 0},
+		{"unverified email", &registration.Identity{Email: "admin@example.org"}, false, 0},
+		{"verified domain", &registration.Identity{Email: "user@example.org", EmailVerified: true}, false, 1},
+		{"unverified domain", &registration.Identity{Email: "user@example.org"}, false, 0},
+		{"group with unverified email", &registration.Identity{Email: "admin@example.org", Groups: []string{"ops"}}, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := p.Access(tt.identity)
+			if a.Unrestricted() != tt.unrestricted || len(a.Sets()) != tt.sets {
+				t.Errorf("expected unrestricted %t with %d sets, got %t with %d sets", tt.unrestricted, tt.sets, a.Unrestricted(), len(a.Sets()))
+			}
+		})
+	}
+}
+
+func mustMatcher(t *testing.T, name, value string) *labels.Matcher {
+	t.Helper()
+
+	m, err := labels.NewMatcher(labels.MatchEqual, name, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
@@ -0,0 +1,104 @@
+package registration
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/storage"
+)
+
+// Identity is user identity verified by identity provider. Email is trusted
+// only if it is verified, otherwise it may be set to any value by user.
+type Identity struct {
+	Subject       string    `json:"subject"`
+	Email         string    `json:"email,omitempty"`
+	EmailVerified bool      `json:"email_verified,omitempty"`
+	Name          string    `json:"name,omitempty"`
+	Groups        []string  `json:"groups,omitempty"`
+	RegisteredAt  time.Time `json:"registered_at"`
+}
+
+// Identities keeps identities bound with chats
+type Identities struct {
+	path       string
+	identities map[string]*Identity
+	mux        sync.Mutex
+}
+
+// NewIdentities loads identities from given file,
+// empty path means that identities will be kept in memory only
+func NewIdentities(path string) (*Identities, error) {
+	i := &Identities{
+		path:       path,
+		identities: make(map[string]*Identity),
+	}
+
+	if path == "" {
+		return i, nil
+	}
+
+	if err := storage.ReadJSON(path, &i.identities); err != nil {
+		return nil, fmt.Errorf("failed to load identities store: %s", err)
+	}
+
+	return i, nil
+}
+
+func (i *Identities) Get(receiver int64) (*Identity, bool) {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	identity, ok := i.identities[strconv.FormatInt(receiver, 10)]
+
+	return identity, ok
+}
+
+func (i *Identities) Set(receiver int64, identity *Identity) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	identity.RegisteredAt = time.Now()
+	i.identities[strconv.FormatInt(receiver, 10)] = identity
+
+	return i.save()
+}
+
+func (i *Identities) Delete(receiver int64) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	delete(i.identities, strconv.FormatInt(receiver, 10))
+
+	return i.save()
+}
+
+// Move binds identity of one receiver with another one
+func (i *Identities) Move(from, to int64) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	identity, ok := i.identities[strconv.FormatInt(from, 10)]
+	if !ok {
+		return nil
+	}
+
+	delete(i.identities, strconv.FormatInt(from, 10))
+	i.identities[strconv.FormatInt(to, 10)] = identity
+
+	return i.save()
+}
+
+// save writes identities to store file, should be called under lock
+func (i *Identities) save() error {
+	if i.path == "" {
+		return nil
+	}
+
+	if err := storage.WriteJSON(i.path, i.identities); err != nil {
+		return fmt.Errorf("failed to save identities store: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package registration
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// time given to user for login in identity provider
+	StateTTL = 10 * time.Minute
+)
+
+var (
+	ErrUnknownState = errors.New("authorization state is unknown or expired")
+	ErrForbidden    = errors.New("identity is not allowed to register")
+)
+
+type OIDCConfig struct {
+	IssuerURL      string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	Scopes         []string
+	GroupsClaim    string
+	AllowedDomains []string
+	AllowedGroups  []string
+}
+
+type state struct {
+	receiver int64
+	// registration token, which is used after successful authorization
+	token     string
+	nonce     string
+	expiresAt time.Time
+}
+
+// OIDC implements authorization code flow, which binds chat id
+// with identity verified by OpenID Connect provider
+type OIDC struct {
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+	config   OIDCConfig
+	states   map[string]state
+	mux      sync.Mutex
+}
+
+func NewOIDC(ctx context.Context, c OIDCConfig) (*OIDC, error) {
+	provider, err := oidc.NewProvider(ctx, c.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider: %s", err)
+	}
+
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID}
+	}
+
+	return &OIDC{
+		oauth2: oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: c.ClientID}),
+		config:   c,
+		states:   make(map[string]state),
+	}, nil
+}
+
+// AuthCodeURL returns identity provider login url for given receiver and its registration
+// token together with authorization state, which must be bound with user browser
+func (o *OIDC) AuthCodeURL(receiver int64, token string) (string, string, error) {
+	key, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	now := time.Now()
+	for k, v := range o.states {
+		if now.After(v.expiresAt) {
+			delete(o.states, k)
+		}
+	}
+	o.states[key] = state{receiver: receiver, token: token, nonce: nonce, expiresAt: now.Add(StateTTL)}
+
+	return o.oauth2.AuthCodeURL(key, oidc.Nonce(nonce)), key, nil
+}
+
+// Exchange finishes authorization flow and returns receiver with its registration token and verified identity
+func (o *OIDC) Exchange(ctx context.Context, key, code string) (int64, string, *Identity, error) {
+	o.mux.Lock()
+	s, ok := o.states[key]
+	delete(o.states, key)
+	o.mux.Unlock()
+
+	if !ok || time.Now().After(s.expiresAt) {
+		return 0, "", nil, ErrUnknownState
+	}
+
+	token, err := o.oauth2.Exchange(ctx, code)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("failed to exchange authorization code: %s", err)
+	}
+
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return 0, "", nil, fmt.Errorf("id_token not found in token response")
+	}
+
+	idToken, err := o.verifier.Verify(ctx, raw)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("failed to verify id_token: %s", err)
+	}
+
+	if idToken.Nonce != s.nonce {
+		return 0, "", nil, fmt.Errorf("id_token nonce mismatch")
+	}
+
+	claims := make(map[string]interface{})
+	if err := idToken.Claims(&claims); err != nil {
+		return 0, "", nil, fmt.Errorf("failed to parse id_token claims: %s", err)
+	}
+
+	identity := identityFromClaims(idToken.Subject, claims, o.config.GroupsClaim)
+	if !o.isAllowed(identity) {
+		return 0, "", identity, ErrForbidden
+	}
+
+	return s.receiver, s.token, identity, nil
+}
+
+func (o *OIDC) isAllowed(identity *Identity) bool {
+	if len(o.config.AllowedDomains) == 0 && len(o.config.AllowedGroups) == 0 {
+		return true
+	}
+
+	if identity.EmailVerified {
+		if n := strings.LastIndex(identity.Email, "@"); n >= 0 {
+			domain := strings.ToLower(identity.Email[n+1:])
+			for _, value := range o.config.AllowedDomains {
+				if strings.ToLower(value) == domain {
+					return true
+				}
+			}
+		}
+	}
+
+	for _, group := range identity.Groups {
+		for _, value := range o.config.AllowedGroups {
+			if value == group {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func identityFromClaims(subject string, claims map[string]interface{}, groupsClaim string) *Identity {
+	identity := &Identity{Subject: subject}
+	identity.Email, _ = claims["email"].(string)
+	identity.EmailVerified, _ = claims["email_verified"].(bool)
+	identity.Name, _ = claims["name"].(string)
+
+	switch v := claims[groupsClaim].(type) {
+	case []interface{}:
+		for _, group := range v {
+			if s, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, s)
+			}
+		}
+	case string:
+		identity.Groups = []string{v}
+	}
+
+	return identity
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random string: %s", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,272 @@
+package registration
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testIssuer is mock oidc provider, which serves discovery, keys and
+// token endpoints and issues id token with given claims for any code
+type testIssuer struct {
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ti := &testIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(t, w, map[string]interface{}{
+			"issuer":                                ti.srv.URL,
+			"authorization_endpoint":                ti.srv.URL + "/authorize",
+			"token_endpoint":                        ti.srv.URL + "/token",
+			"jwks_uri":                              ti.srv.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(t, w, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("code") != "code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+
+			return
+		}
+		writeTestJSON(t, w, map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     ti.sign(t, ti.claims),
+		})
+	})
+	ti.srv = httptest.NewServer(mux)
+	t.Cleanup(ti.srv.Close)
+
+	return ti
+}
+
+// sign returns RS256 signed jwt with given claims
+func (ti *testIssuer) sign(t *testing.T, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(input))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, ti.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writeTestJSON(t *testing.T, w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		t.Errorf("failed to encode response: %s", err)
+	}
+}
+
+func newTestOIDC(t *testing.T, ti *testIssuer, domains, groups []string) *OIDC {
+	t.Helper()
+
+	o, err := NewOIDC(context.Background(), OIDCConfig{
+		IssuerURL:      ti.srv.URL,
+		ClientID:       "bot",
+		ClientSecret:   "secret",
+		RedirectURL:    "http://bot/auth/callback",
+		GroupsClaim:    "groups",
+		AllowedDomains: domains,
+		AllowedGroups:  groups,
+	})
+	if err != nil {
+		t.Fatalf("failed to initialize oidc: %s", err)
+	}
+
+	return o
+}
+
+// authorize starts authorization and returns state with nonce passed to identity provider
+func authorize(t *testing.T, o *OIDC, receiver int64) (string, string) {
+	t.Helper()
+
+	u, state, err := o.AuthCodeURL(receiver, "registration-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Query().Get("state"); got != state {
+		t.Fatalf("expected state %q in auth url, got %q", state, got)
+	}
+
+	return state, parsed.Query().Get("nonce")
+}
+
+func TestOIDCExchange(t *testing.T) {
+	ti := newTestIssuer(t)
+
+	tests := []struct {
+		name    string
+		domains []string
+		groups  []string
+		claims  map[string]interface{}
+		nonce   string
+		err     error
+		failed  bool
+	}{
+		{
+			name:   "any identity is allowed without restrictions",
+			claims: map[string]interface{}{"email": "user@other.com"},
+		},
+		{
+			name:    "verified email of allowed domain",
+			domains: []string{"example.com"},
+			claims:  map[string]interface{}{"email": "user@Example.com", "email_verified": true},
+		},
+		{
+			name:    "unverified email of allowed domain",
+			domains: []string{"example.com"},
+			claims:  map[string]interface{}{"email": "user@example.com", "email_verified": false},
+			err:     ErrForbidden,
+		},
+		{
+			name:    "email without verification claim",
+			domains: []string{"example.com"},
+			claims:  map[string]interface{}{"email": "user@example.com"},
+			err:     ErrForbidden,
+		},
+		{
+			name:    "email of another domain",
+			domains: []string{"example.com"},
+			claims:  map[string]interface{}{"email": "user@other.com", "email_verified": true},
+			err:     ErrForbidden,
+		},
+		{
+			name:   "allowed group",
+			groups: []string{"ops"},
+			claims: map[string]interface{}{"email": "user@other.com", "groups": []string{"dev", "ops"}},
+		},
+		{
+			name:   "another group",
+			groups: []string{"ops"},
+			claims: map[string]interface{}{"groups": "dev"},
+			err:    ErrForbidden,
+		},
+		{
+			name:   "nonce mismatch",
+			claims: map[string]interface{}{},
+			nonce:  "other",
+			failed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOIDC(t, ti, tt.domains, tt.groups)
+			state, nonce := authorize(t, o, 100)
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+
+			now := time.Now()
+			ti.claims = map[string]interface{}{
+				"iss":   ti.srv.URL,
+				"aud":   "bot",
+				"sub":   "user",
+				"iat":   now.Unix(),
+				"exp":   now.Add(time.Hour).Unix(),
+				"nonce": nonce,
+			}
+			for k, v := range tt.claims {
+				ti.claims[k] = v
+			}
+
+			receiver, token, identity, err := o.Exchange(context.Background(), state, "code")
+			if tt.failed {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+
+				return
+			}
+			if err != tt.err {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if receiver != 100 || token != "registration-token" {
+				t.Errorf("unexpected receiver %d with token %q", receiver, token)
+			}
+			if identity.Subject != "user" || identity.Email != tt.claims["email"] {
+				t.Errorf("unexpected identity %+v", identity)
+			}
+		})
+	}
+}
+
+func TestOIDCExchangeState(t *testing.T) {
+	ti := newTestIssuer(t)
+	o := newTestOIDC(t, ti, nil, nil)
+
+	if _, _, _, err := o.Exchange(context.Background(), "unknown", "code"); err != ErrUnknownState {
+		t.Errorf("expected ErrUnknownState, got %v", err)
+	}
+
+	state, nonce := authorize(t, o, 100)
+	now := time.Now()
+	ti.claims = map[string]interface{}{
+		"iss":   ti.srv.URL,
+		"aud":   "bot",
+		"sub":   "user",
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+	if _, _, _, err := o.Exchange(context.Background(), state, "code"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// state is single use
+	if _, _, _, err := o.Exchange(context.Background(), state, "code"); err != ErrUnknownState {
+		t.Errorf("expected ErrUnknownState on repeated exchange, got %v", err)
+	}
+}
@@ -0,0 +1,174 @@
+package registration
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sputnik-systems/alertmanager_bot/internal/storage"
+)
+
+var (
+	ErrInvalidToken = errors.New("registration token is invalid")
+	ErrExpiredToken = errors.New("registration token is expired")
+	ErrUsedToken    = errors.New("registration token is already used")
+)
+
+// Issuer issues and verifies one-time registration tokens bound to chat id.
+// Token is signed with HMAC, so it can't be forged without server secret.
+type Issuer struct {
+	secret []byte
+	ttl    time.Duration
+	path   string
+	// nonces of used tokens with their expiration time
+	used map[string]time.Time
+	mux  sync.Mutex
+}
+
+// New returns tokens issuer, random secret will be generated if given one is empty.
+// Used tokens are stored in given file, empty path means that they will be kept
+// in memory only.
+func New(secret string, ttl time.Duration, path string) (*Issuer, error) {
+	key := []byte(secret)
+	if secret == "" {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate registration secret: %s", err)
+		}
+	}
+
+	i := &Issuer{
+		secret: key,
+		ttl:    ttl,
+		path:   path,
+		used:   make(map[string]time.Time),
+	}
+
+	if path == "" {
+		return i, nil
+	}
+
+	if err := storage.ReadJSON(path, &i.used); err != nil {
+		return nil, fmt.Errorf("failed to load used registration tokens: %s", err)
+	}
+
+	return i, nil
+}
+
+// Issue returns new token for given receiver
+func (i *Issuer) Issue(receiver int64) (string, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate token nonce: %s", err)
+	}
+
+	payload := fmt.Sprintf("%d:%d:%s", receiver, time.Now().Add(i.ttl).Unix(), hex.EncodeToString(nonce))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + i.sign(payload), nil
+}
+
+// Verify checks, that token is issued for given receiver and isn't used yet
+func (i *Issuer) Verify(token string, receiver int64) error {
+	nonce, _, err := i.parse(token, receiver)
+	if err != nil {
+		return err
+	}
+
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	if _, ok := i.used[nonce]; ok {
+		return ErrUsedToken
+	}
+
+	return nil
+}
+
+// Use verifies token and marks it as used, it is called
+// after successful registration, so failed one may be repeated
+func (i *Issuer) Use(token string, receiver int64) error {
+	nonce, expiresAt, err := i.parse(token, receiver)
+	if err != nil {
+		return err
+	}
+
+	i.mux.Lock()
+	defer i.mux.Unlock()
+
+	now := time.Now()
+	for key, value := range i.used {
+		if now.After(value) {
+			delete(i.used, key)
+		}
+	}
+
+	if _, ok := i.used[nonce]; ok {
+		return ErrUsedToken
+	}
+	i.used[nonce] = expiresAt
+
+	if i.path == "" {
+		return nil
+	}
+
+	if err := storage.WriteJSON(i.path, i.used); err != nil {
+		return fmt.Errorf("failed to save used registration tokens: %s", err)
+	}
+
+	return nil
+}
+
+// parse returns nonce and expiration time of valid token issued for given receiver
+func (i *Issuer) parse(token string, receiver int64) (string, time.Time, error) {
+	v := strings.Split(token, ".")
+	if len(v) != 2 {
+		return "", time.Time{}, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(v[0])
+	if err != nil {
+		return "", time.Time{}, ErrInvalidToken
+	}
+	payload := string(data)
+
+	if !hmac.Equal([]byte(i.sign(payload)), []byte(v[1])) {
+		return "", time.Time{}, ErrInvalidToken
+	}
+
+	fields := strings.Split(payload, ":")
+	if len(fields) != 3 {
+		return "", time.Time{}, ErrInvalidToken
+	}
+
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || id != receiver {
+		return "", time.Time{}, ErrInvalidToken
+	}
+
+	exp, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, ErrInvalidToken
+	}
+	expiresAt := time.Unix(exp, 0)
+
+	if time.Now().After(expiresAt) {
+		return "", time.Time{}, ErrExpiredToken
+	}
+
+	return fields[2], expiresAt, nil
+}
+
+func (i *Issuer) sign(payload string) string {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
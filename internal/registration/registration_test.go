@@ -0,0 +1,91 @@
+package registration
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIssuer(t *testing.T) {
+	i, err := New("secret", time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := i.Issue(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := i.Verify(token, 200); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for another receiver, got %v", err)
+	}
+	if err := i.Verify(token+"x", 100); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for broken signature, got %v", err)
+	}
+
+	// token isn't used by verification, so failed registration may be repeated
+	for n := 0; n < 2; n++ {
+		if err := i.Verify(token, 100); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if err := i.Use(token, 100); err != nil {
+		t.Fatalf("failed to use token: %s", err)
+	}
+	if err := i.Verify(token, 100); err != ErrUsedToken {
+		t.Errorf("expected ErrUsedToken, got %v", err)
+	}
+	if err := i.Use(token, 100); err != ErrUsedToken {
+		t.Errorf("expected ErrUsedToken, got %v", err)
+	}
+
+	other, err := New("other", time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Verify(token, 100); err != ErrInvalidToken {
+		t.Errorf("expected ErrInvalidToken for another secret, got %v", err)
+	}
+}
+
+func TestIssuerExpiredToken(t *testing.T) {
+	i, err := New("secret", -time.Second, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := i.Issue(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Verify(token, 100); err != ErrExpiredToken {
+		t.Errorf("expected ErrExpiredToken, got %v", err)
+	}
+}
+
+func TestIssuerStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registration.json")
+
+	i, err := New("secret", time.Minute, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := i.Issue(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Use(token, 100); err != nil {
+		t.Fatalf("failed to use token: %s", err)
+	}
+
+	// used tokens are kept after restart
+	restarted, err := New("secret", time.Minute, path)
+	if err != nil {
+		t.Fatalf("failed to load store: %s", err)
+	}
+	if err := restarted.Verify(token, 100); err != ErrUsedToken {
+		t.Errorf("expected ErrUsedToken after restart, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ReadJSON reads json file into v, missing file is not an error
+func ReadJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read file: %s", err)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse file: %s", err)
+	}
+
+	return nil
+}
+
+// WriteJSON atomically replaces file content with v encoded as json
+func WriteJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal data: %s", err)
+	}
+
+	return WriteFile(path, data)
+}
+
+// WriteFile atomically replaces file content with given data
+func WriteFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %s", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// keep permissions of replaced file, temporary file is created with 0600
+	if fi, err := os.Stat(path); err == nil {
+		if err := tmp.Chmod(fi.Mode().Perm()); err != nil {
+			tmp.Close()
+
+			return fmt.Errorf("failed to set temporary file mode: %s", err)
+		}
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("failed to write temporary file: %s", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write temporary file: %s", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace file: %s", err)
+	}
+
+	return nil
+}